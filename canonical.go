@@ -0,0 +1,99 @@
+package gocrawl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/PuerkitoBio/purell"
+	"github.com/andybalholm/cascadia"
+)
+
+var canonicalMatcher = cascadia.MustCompile("link[rel][href]")
+
+// Get the normalized canonical URL declared by the response, either in a
+// Link header or in a link tag of the document (the header has precedence).
+// It returns nil if no valid absolute http(s) canonical URL is declared.
+func getCanonicalURL(ctx *URLContext, h http.Header, doc *goquery.Document, normFlags purell.NormalizationFlags) *url.URL {
+	var u *url.URL
+
+	for _, v := range h.Values("Link") {
+		if s := canonicalFromLinkHeader(v); s != "" {
+			if parsed, err := url.Parse(s); err == nil {
+				u = ctx.url.ResolveReference(parsed)
+				break
+			}
+		}
+	}
+
+	if u == nil && doc != nil {
+		baseURL, _ := doc.FindMatcher(baseHrefMatcher).Attr("href")
+		doc.FindMatcher(canonicalMatcher).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			if rel, _ := s.Attr("rel"); !hasRel(rel, "canonical") {
+				return true
+			}
+			href, _ := s.Attr("href")
+			if href = strings.TrimSpace(href); href == "" {
+				return true
+			}
+			if baseURL != "" {
+				href = handleBaseTag(doc.Url, baseURL, href)
+			}
+			if parsed, err := url.Parse(href); err == nil {
+				u = doc.Url.ResolveReference(parsed)
+			}
+			return false
+		})
+	}
+
+	if u == nil || !u.IsAbs() || !strings.HasPrefix(u.Scheme, "http") {
+		return nil
+	}
+	purell.NormalizeURL(u, normFlags)
+	return u
+}
+
+// Get the target of the canonical link in the value of a Link header, e.g.
+// `<http://host/a>; rel="canonical"`, or an empty string if there is none.
+func canonicalFromLinkHeader(v string) string {
+	for len(v) > 0 {
+		start := strings.Index(v, "<")
+		if start < 0 {
+			return ""
+		}
+		end := strings.Index(v[start:], ">")
+		if end < 0 {
+			return ""
+		}
+		target := v[start+1 : start+end]
+		v = v[start+end+1:]
+
+		// The parameters of this link end at the next link
+		params := v
+		if i := strings.Index(v, "<"); i >= 0 {
+			params = v[:i]
+		}
+		for _, p := range strings.Split(params, ";") {
+			i := strings.Index(p, "=")
+			if i < 0 || !strings.EqualFold(strings.TrimSpace(p[:i]), "rel") {
+				continue
+			}
+			val := strings.TrimRight(strings.TrimSpace(p[i+1:]), ", ")
+			if hasRel(strings.Trim(val, `"`), "canonical") {
+				return strings.TrimSpace(target)
+			}
+		}
+	}
+	return ""
+}
+
+// Check if the space-separated list of rel values contains the value.
+func hasRel(rel, value string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package gocrawl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestCanonicalFromLinkHeader(t *testing.T) {
+	cases := []struct {
+		in  string
+		out string
+	}{
+		{`<http://host/a>; rel="canonical"`, "http://host/a"},
+		{`<http://host/a>; rel=canonical`, "http://host/a"},
+		{`</a>; REL="Canonical"`, "/a"},
+		{`<http://host/p2>; rel="next", <http://host/a>; rel="canonical"`, "http://host/a"},
+		{`<http://host/a>; rel="alternate canonical"; hreflang="en"`, "http://host/a"},
+		{`<http://host/a>; rel="next"`, ""},
+		{`<http://host/a>; title="canonical"`, ""},
+		{`http://host/a; rel="canonical"`, ""},
+		{``, ""},
+	}
+	for _, c := range cases {
+		if got := canonicalFromLinkHeader(c.in); got != c.out {
+			t.Errorf("%s: want %q, got %q", c.in, c.out, got)
+		}
+	}
+}
+
+func TestGetCanonicalURL(t *testing.T) {
+	cases := []struct {
+		header string
+		html   string
+		out    string
+	}{
+		{"", `<link rel="canonical" href="/a">`, "http://host/a"},
+		{"", `<base href="http://host/dir/"><link rel="canonical" href="a">`, "http://host/dir/a"},
+		{"", `<link rel="stylesheet" href="/s.css"><link rel="canonical" href="HTTP://Host/a">`, "http://host/a"},
+		{`</h>; rel="canonical"`, `<link rel="canonical" href="/a">`, "http://host/h"},
+		{"", `<link rel="canonical" href="ftp://host/a">`, ""},
+		{"", `<link rel="canonical" href="">`, ""},
+		{"", `<a rel="canonical" href="/a">a</a>`, ""},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse("http://host/page?x=1")
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(c.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.Url = u
+		h := http.Header{}
+		if c.header != "" {
+			h.Set("Link", c.header)
+		}
+		ctx := newURLContext(u, nil, &Options{URLNormalizationFlags: DefaultNormalizationFlags})
+		got := getCanonicalURL(ctx, h, doc, DefaultNormalizationFlags)
+		if (got == nil && c.out != "") || (got != nil && got.String() != c.out) {
+			t.Errorf("%s %s: want %q, got %v", c.header, c.html, c.out, got)
+		}
+	}
+}
+
+func TestCanonicalIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/p":
+			if r.URL.RawQuery != "" {
+				w.Write([]byte(`<html><head><link rel="canonical" href="/p"></head><body><a href="/p">p</a> <a href="/h?x=1">h</a></body></html>`))
+				return
+			}
+			w.Write([]byte(`<html><body>p</body></html>`))
+		case "/h":
+			if r.URL.RawQuery != "" {
+				w.Header().Set("Link", `</h>; rel="canonical"`)
+			}
+			w.Write([]byte(`<html><body><a href="/h">h</a></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, canonical := range []bool{false, true} {
+		spy := newSpy(new(DefaultExtender), true)
+		opts := NewOptions(spy)
+		opts.CrawlDelay = 0
+		opts.LogFlags = LogAll
+		opts.CanonicalIdentity = canonical
+		c := NewCrawlerWithOptions(opts)
+		c.Run(srv.URL + "/p?x=1")
+
+		// Without canonical identity, /p and /h are visited too
+		wantVisits := 4
+		if canonical {
+			wantVisits = 2
+		}
+		assertCallCount(spy, "CanonicalIdentity", eMKVisit, wantVisits, t)
+		if canonical {
+			assertIsInLog("CanonicalIdentity", spy.b, "canonical of "+srv.URL+"/p?x=1: "+srv.URL+"/p\n", t)
+			assertIsInLog("CanonicalIdentity", spy.b, "canonical of "+srv.URL+"/h?x=1: "+srv.URL+"/h\n", t)
+		}
+	}
+}
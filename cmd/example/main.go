@@ -24,23 +24,18 @@ func (e *Ext) Visit(ctx *gocrawl.URLContext, res *http.Response, doc *goquery.Do
 	return nil, true
 }
 
-func (e *Ext) Filter(ctx *gocrawl.URLContext, isVisited bool) bool {
-	if isVisited {
-		return false
-	}
-	if ctx.URL().Host == "github.com" || ctx.URL().Host == "golang.org" || ctx.URL().Host == "www.0value.com" {
-		return true
-	}
-	return false
-}
-
 func main() {
 	ext := &Ext{&gocrawl.DefaultExtender{}}
 	// Set custom options
 	opts := gocrawl.NewOptions(ext)
 	opts.CrawlDelay = 1 * time.Second
 	opts.LogFlags = gocrawl.LogError
-	opts.SameHostOnly = false
+	opts.Scope = gocrawl.ScopeHostList
+	opts.AllowedHosts = []string{"github.com", "golang.org", "www.0value.com"}
+	opts.ExcludeRules = []*gocrawl.URLRule{
+		{Name: "images", Regexp: `\.(png|jpe?g|gif)$`},
+		{Name: "github-issues", Glob: "/*/*/issues/**"},
+	}
 	opts.MaxVisits = 100
 
 	log.Print("starting crawl...")
@@ -1,12 +1,23 @@
 package gocrawl
 
 import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 func testNoCrawlDelay(t *testing.T, tc *testCase, buf bool) {
@@ -132,7 +143,7 @@ func testRunTwiceSameInstance(t *testing.T, tc *testCase, buf bool) {
 	assertCallCount(spy, tc.name, eMKFilter, 11, t)
 }
 
-func testEnqueueChanEmbedded(t *testing.T, tc *testCase, buf bool) {
+func testEnqueuerEmbedded(t *testing.T, tc *testCase, buf bool) {
 	type MyExt struct {
 		SomeFieldBefore bool
 		*DefaultExtender
@@ -140,32 +151,46 @@ func testEnqueueChanEmbedded(t *testing.T, tc *testCase, buf bool) {
 	}
 	me := &MyExt{false, new(DefaultExtender), 0}
 	c := NewCrawler(me)
-	assertTrue(me.EnqueueChan == nil, "expected EnqueueChan to be nil")
+	assertTrue(me.Enqueuer == nil, "expected Enqueuer to be nil")
 
 	c.Run(nil)
 
-	assertTrue(me.EnqueueChan != nil, "expected EnqueueChan to be non-nil")
-	me.EnqueueChan <- "test"
-	l := len(me.EnqueueChan)
-	assertTrue(l == 1, "expected EnqueueChan to have 1 element, got %d", l)
+	assertTrue(me.Enqueuer != nil, "expected Enqueuer to be non-nil")
+	err := me.Enqueuer.Enqueue("test")
+	assertTrue(err == ErrNotRunning, "expected error to be ErrNotRunning, got %v", err)
 }
 
-func testEnqueueChanShadowed(t *testing.T, tc *testCase, buf bool) {
-	type ShadowExt struct {
-		*spyExtender
-		EnqueueChan int
-	}
-	me := &ShadowExt{
-		newSpy(new(DefaultExtender), buf),
-		0,
-	}
-	opts := NewOptions(me)
-	opts.LogFlags = LogInfo
-	c := NewCrawlerWithOptions(opts)
-
-	c.Run("")
+func testEnqueueNotRunning(t *testing.T, tc *testCase, buf bool) {
+	c := NewCrawler(newSpy(new(DefaultExtender), buf))
+	err := c.Enqueue("http://hosta/page1.html")
+	assertTrue(err == ErrNotRunning, "expected error to be ErrNotRunning, got %v", err)
+}
 
-	assertIsInLog(tc.name, me.b, "extender.EnqueueChan is not of type chan<-interface{}, cannot set the enqueue channel\n", t)
+func testEnqueueClosed(t *testing.T, tc *testCase, buf bool) {
+	c := NewCrawler(newSpy(new(DefaultExtender), buf))
+	c.enqueue, c.stop = make(chan interface{}, 1), make(chan struct{})
+
+	err := c.Enqueue("http://hosta/page1.html")
+	assertTrue(err == nil, "expected no error, got %v", err)
+	assertTrue(!c.closeEnqueue(), "expected the crawler not to end with a buffered URL")
+
+	<-c.enqueue
+	assertTrue(c.closeEnqueue(), "expected the crawler to end with an empty buffer")
+	err = c.Enqueue("http://hosta/page2.html")
+	assertTrue(err == ErrNotRunning, "expected error to be ErrNotRunning, got %v", err)
+	assertTrue(len(c.enqueue) == 0, "expected no URL in the buffer, got %d", len(c.enqueue))
+
+	// A URL sent to a full buffer is received before the crawler ends
+	c.enqueueClosed = false
+	c.enqueue <- "http://hosta/page3.html"
+	errc := make(chan error)
+	go func() { errc <- c.Enqueue("http://hosta/page4.html") }()
+	time.Sleep(10 * time.Millisecond)
+	<-c.enqueue
+	assertTrue(!c.closeEnqueue(), "expected the crawler not to end while a URL is sent")
+	assertTrue(<-c.enqueue == "http://hosta/page4.html", "expected page4 in the buffer")
+	assertTrue(<-errc == nil, "expected no error")
+	assertTrue(c.closeEnqueue(), "expected the crawler to end with an empty buffer")
 }
 
 func testEnqueueNewURL(t *testing.T, tc *testCase, buf bool) {
@@ -183,7 +208,9 @@ func testEnqueueNewURL(t *testing.T, tc *testCase, buf bool) {
 			if err != nil {
 				panic(err)
 			}
-			spy.EnqueueChan <- newU
+			if err := spy.Enqueuer.Enqueue(newU); err != nil {
+				panic(err)
+			}
 			enqueued = true
 		}
 	})
@@ -219,8 +246,10 @@ func testEnqueueNewURLOnError(t *testing.T, tc *testCase, buf bool) {
 			once = true
 			// copy the URL first, otherwise creates a race
 			u := *err.Ctx.URL()
-			spy.EnqueueChan <- map[*url.URL]interface{}{
+			if err := spy.Enqueuer.Enqueue(map[*url.URL]interface{}{
 				&u: "Error",
+			}); err != nil {
+				panic(err)
 			}
 		}
 	})
@@ -235,4 +264,601 @@ func testEnqueueNewURLOnError(t *testing.T, tc *testCase, buf bool) {
 	assertCallCount(spy, tc.name, eMKEnqueued, 3, t) // Twice and robots.txt
 }
 
+func testResumeFromStore(t *testing.T, tc *testCase, buf bool) {
+	dir, err := ioutil.TempDir("", "gocrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileStore(filepath.Join(dir, "frontier"))
+
+	visited := make(map[string]bool)
+	countVisits := func(ctx *URLContext, harvested interface{}) {
+		visited[ctx.normalizedURL.String()] = true
+	}
+
+	ff := newFileFetcher()
+	spy := newSpy(ff, buf)
+	spy.setExtensionMethod(eMKVisited, countVisits)
+	opts := NewOptions(spy)
+	opts.SameHostOnly = true
+	opts.CrawlDelay = DefaultTestCrawlDelay
+	opts.MaxVisits = 2
+	opts.LogFlags = LogAll
+	opts.Store = store
+	c := NewCrawlerWithOptions(opts)
+
+	err = c.Run([]string{
+		"http://hosta/page1.html",
+		"http://hosta/page4.html",
+	})
+	assertTrue(err == ErrMaxVisits, "expected error to be ErrMaxVisits, got %v", err)
+	fr, err := store.Load()
+	if assertTrue(err == nil, "%s", err) {
+		assertTrue(len(fr.Pending) > 0, "expected pending URLs to be saved")
+	}
+
+	// Resume without seeds, must visit the remaining pages only
+	spy = newSpy(ff, buf)
+	spy.setExtensionMethod(eMKVisited, countVisits)
+	opts.Extender = spy
+	opts.MaxVisits = 0
+	c = NewCrawlerWithOptions(opts)
+
+	err = c.Run(nil)
+	assertTrue(err == nil, "expected no error, got %v", err)
+	cnt := spy.getCallCount(eMKVisited)
+	assertTrue(cnt == 3, "expected 3 visits on resume, got %d", cnt)
+	assertTrue(len(visited) == 5, "expected 5 distinct pages visited, got %d", len(visited))
+	fr, err = store.Load()
+	if assertTrue(err == nil, "%s", err) {
+		assertTrue(len(fr.Pending) == 0, "expected no pending URLs, got %d", len(fr.Pending))
+	}
+}
+
+func testRunContextDeadline(t *testing.T, tc *testCase, buf bool) {
+	const MaxTime = time.Second
+
+	aborted := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			return
+		}
+		// Hang until the request is aborted
+		select {
+		case <-r.Context().Done():
+			aborted <- struct{}{}
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.RunContext(ctx, srv.URL+"/slow")
+	elps := time.Now().Sub(start)
+
+	assertTrue(err == context.DeadlineExceeded, "expected error to be context.DeadlineExceeded, got %v", err)
+	assertTrue(elps < MaxTime, "expected elapsed time to be less than %v, got %v", MaxTime, elps)
+	select {
+	case <-aborted:
+	case <-time.After(MaxTime):
+		assertTrue(false, "expected in-flight request to be aborted")
+	}
+	assertCallCount(spy, tc.name, eMKError, 0, t)
+
+	// Stopping after the end is a no-op
+	c.Stop()
+	c.Stop()
+}
+
+func testPriority(t *testing.T, tc *testCase, buf bool) {
+	var order []string
+
+	ff := newFileFetcher()
+	spy := newSpy(ff, buf)
+	spy.setExtensionMethod(eMKEnqueued, func(ctx *URLContext) {
+		switch ctx.normalizedURL.Path {
+		case "/page5.html":
+			ctx.Priority = 10
+		case "/page4.html":
+			ctx.Priority = 5
+		}
+	})
+	spy.setExtensionMethod(eMKVisit, func(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+		order = append(order, ctx.normalizedURL.Path)
+		return nil, false
+	})
+
+	opts := NewOptions(spy)
+	opts.SameHostOnly = true
+	opts.CrawlDelay = DefaultTestCrawlDelay
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run([]string{
+		"http://hosta/page1.html",
+		"http://hosta/page4.html",
+		"http://hosta/page5.html",
+	})
+
+	want := []string{"/page5.html", "/page4.html", "/page1.html"}
+	assertTrue(reflect.DeepEqual(order, want), "expected visit order %v, got %v", want, order)
+}
+
+// Returns a test server that fails with a 503 status code the first
+// failures times that /page is requested.
+func newFailingServer(failures int) (*httptest.Server, *int32) {
+	var cnt int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		if n := atomic.AddInt32(&cnt, 1); int(n) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	return srv, &cnt
+}
+
+func testRetryStatusCode(t *testing.T, tc *testCase, buf bool) {
+	srv, cnt := newFailingServer(2)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	opts.RetryPolicy = NewRetryPolicy()
+	opts.RetryPolicy.InitialBackoff = 10 * time.Millisecond
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/page")
+
+	assertTrue(atomic.LoadInt32(cnt) == 3, "expected 3 requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 1, t)
+	assertCallCount(spy, tc.name, eMKError, 0, t)
+	assertIsInLog(tc.name, spy.b, "retry #2 of "+srv.URL+"/page", t)
+}
+
+func testRetryGiveUp(t *testing.T, tc *testCase, buf bool) {
+	srv, cnt := newFailingServer(5)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	spy.setExtensionMethod(eMKError, func(err *CrawlError) {
+		assertTrue(err.Kind == CekHttpStatusCode, "expected error kind %s, got %s", CekHttpStatusCode, err.Kind)
+	})
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	opts.RetryPolicy = &RetryPolicy{
+		MaxAttempts:    2,
+		InitialBackoff: 10 * time.Millisecond,
+		StatusCodes:    []int{http.StatusServiceUnavailable},
+	}
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/page")
+
+	assertTrue(atomic.LoadInt32(cnt) == 2, "expected 2 requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 0, t)
+	assertCallCount(spy, tc.name, eMKError, 1, t)
+}
+
+type retrierExtender struct {
+	*spyExtender
+	attempts []int
+}
+
+func (x *retrierExtender) Retry(ctx *URLContext, res *http.Response, err error, attempt int) (time.Duration, bool) {
+	x.attempts = append(x.attempts, attempt)
+	return time.Millisecond, res != nil && res.StatusCode == http.StatusServiceUnavailable
+}
+
+func testRetrierExtender(t *testing.T, tc *testCase, buf bool) {
+	srv, cnt := newFailingServer(3)
+	defer srv.Close()
+
+	ext := &retrierExtender{spyExtender: newSpy(new(DefaultExtender), buf)}
+	opts := NewOptions(ext)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/page")
+
+	assertTrue(atomic.LoadInt32(cnt) == 4, "expected 4 requests, got %d", atomic.LoadInt32(cnt))
+	assertTrue(reflect.DeepEqual(ext.attempts, []int{1, 2, 3}), "expected attempts [1 2 3], got %v", ext.attempts)
+	assertCallCount(ext.spyExtender, tc.name, eMKVisit, 1, t)
+}
+
+func testRetrierThrottleDeclined(t *testing.T, tc *testCase, buf bool) {
+	var cnt int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&cnt, 1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	ext := &retrierExtender{spyExtender: newSpy(new(DefaultExtender), buf)}
+	opts := NewOptions(ext)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/page")
+
+	// The Retrier declines the throttled response, it is asked only once
+	assertTrue(atomic.LoadInt32(&cnt) == 1, "expected 1 request, got %d", atomic.LoadInt32(&cnt))
+	assertTrue(reflect.DeepEqual(ext.attempts, []int{1}), "expected attempts [1], got %v", ext.attempts)
+	assertCallCount(ext.spyExtender, tc.name, eMKError, 1, t)
+}
+
+func testRetryAfterThrottle(t *testing.T, tc *testCase, buf bool) {
+	var cnt int32
+	var first, second time.Time
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&cnt, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		second = time.Now()
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer srv.Close()
+
+	var retryAfter time.Duration
+	spy := newSpy(new(DefaultExtender), buf)
+	spy.setExtensionMethod(eMKComputeDelay, func(host string, di *DelayInfo, lastFetch *FetchInfo) time.Duration {
+		if lastFetch != nil && lastFetch.StatusCode == http.StatusTooManyRequests {
+			assertTrue(di.RetryAfter == lastFetch.RetryAfter, "expected DelayInfo and FetchInfo Retry-After to match")
+			retryAfter = lastFetch.RetryAfter
+		}
+		return (&DefaultExtender{}).ComputeDelay(host, di, lastFetch)
+	})
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/page")
+
+	assertTrue(atomic.LoadInt32(&cnt) == 2, "expected 2 requests, got %d", atomic.LoadInt32(&cnt))
+	assertTrue(retryAfter == time.Second, "expected Retry-After of 1s, got %v", retryAfter)
+	assertTrue(second.Sub(first) >= time.Second, "expected a pause of at least 1s, got %v", second.Sub(first))
+	assertCallCount(spy, tc.name, eMKVisit, 1, t)
+	assertCallCount(spy, tc.name, eMKError, 0, t)
+}
+
+func testMaxConcurrentHosts(t *testing.T, tc *testCase, buf bool) {
+	var active, maxActive int32
+
+	ff := newFileFetcher()
+	spy := newSpy(ff, buf)
+	spy.setExtensionMethod(eMKFetch, func(ctx *URLContext, agent string, head bool) (*http.Response, error) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return ff.Fetch(ctx, agent, head)
+	})
+
+	opts := NewOptions(spy)
+	opts.SameHostOnly = false
+	opts.CrawlDelay = 0
+	opts.MaxConcurrentHosts = 1
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run([]string{
+		"http://hosta/page1.html",
+		"http://hostb/page1.html",
+		"http://hostc/page1.html",
+	})
+
+	assertTrue(atomic.LoadInt32(&maxActive) == 1, "expected at most 1 concurrent fetch, got %d", atomic.LoadInt32(&maxActive))
+	assertCallCount(spy, tc.name, eMKVisit, 7, t)
+}
+
+func newSitemapServer() *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow:\nSitemap: %s/sitemap_index.xml\n", srv.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%[1]s/sitemap.xml.gz</loc></sitemap>`+
+				`<sitemap><loc>/moved.xml</loc></sitemap></sitemapindex>`, srv.URL)
+		case "/sitemap.xml.gz":
+			gz := gzip.NewWriter(w)
+			fmt.Fprintf(gz, `<urlset><url><loc>%[1]s/a</loc><priority>0.9</priority></url>`+
+				`<url><loc>%[1]s/b</loc></url><url><loc>http://other.host/c</loc></url></urlset>`, srv.URL)
+			gz.Close()
+		case "/moved.xml":
+			http.Redirect(w, r, "/sitemap2.xml", http.StatusMovedPermanently)
+		case "/sitemap2.xml":
+			w.Write([]byte(`<urlset><url><loc>/c</loc></url></urlset>`))
+		default:
+			w.Write([]byte("<html><body>ok</body></html>"))
+		}
+	}))
+	return srv
+}
+
+func testFetchSitemaps(t *testing.T, tc *testCase, buf bool) {
+	var mu sync.Mutex
+	visited := make(map[string]*SitemapEntry)
+
+	srv := newSitemapServer()
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	spy.setExtensionMethod(eMKVisit, func(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+		mu.Lock()
+		visited[ctx.URL().Path] = ctx.Sitemap()
+		mu.Unlock()
+		return nil, false
+	})
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.FetchSitemaps = true
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	assertTrue(len(visited) == 4, "expected 4 visits, got %v", visited)
+	for _, p := range []string{"/a", "/b", "/c"} {
+		assertTrue(visited[p] != nil, "expected a sitemap entry for %s", p)
+	}
+	assertTrue(visited["/"] == nil, "expected no sitemap entry for the seed")
+	assertTrue(visited["/a"].Priority == 0.9, "expected priority 0.9, got %v", visited["/a"].Priority)
+	assertTrue(visited["/a"].Sitemap.Path == "/sitemap.xml.gz", "expected sitemap.xml.gz, got %s", visited["/a"].Sitemap)
+	assertIsInLog(tc.name, spy.b, "sitemap "+srv.URL+"/sitemap_index.xml: 0 URL(s), 2 sitemap(s)", t)
+	assertCallCount(spy, tc.name, eMKError, 0, t)
+}
+
+type sitemapRequesterExtender struct {
+	*spyExtender
+}
+
+func (x sitemapRequesterExtender) RequestSitemap(ctx *URLContext) bool {
+	return ctx.URL().Path != "/moved.xml"
+}
+
+func testSitemapRequester(t *testing.T, tc *testCase, buf bool) {
+	srv := newSitemapServer()
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(sitemapRequesterExtender{spy})
+	opts.CrawlDelay = 0
+	opts.FetchSitemaps = true
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	assertCallCount(spy, tc.name, eMKVisit, 3, t)
+	assertIsInLog(tc.name, spy.b, "ignore on sitemap policy: "+srv.URL+"/moved.xml", t)
+}
+
+func testCrossHostSitemap(t *testing.T, tc *testCase, buf bool) {
+	var mu sync.Mutex
+	var paths []string
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private.xml\n"))
+		case "/sitemap.xml":
+			w.Write([]byte(`<urlset><url><loc>/x</loc></url></urlset>`))
+		default:
+			w.Write([]byte("<html><body>ok</body></html>"))
+		}
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %[1]s/sitemap.xml\nSitemap: %[1]s/private.xml\n", other.URL)
+			return
+		}
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.SameHostOnly = false
+	opts.FetchSitemaps = true
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	// The sitemaps of the other host are fetched by its worker, as per its
+	// robots.txt
+	want := []string{"/robots.txt", "/sitemap.xml", "/x"}
+	assertTrue(reflect.DeepEqual(paths, want), "expected requests %v, got %v", want, paths)
+	assertCallCount(spy, tc.name, eMKVisit, 2, t)
+	assertIsInLog(tc.name, spy.b, "ignored on robots.txt policy: "+other.URL+"/private.xml", t)
+}
+
+// Start a server whose robots.txt responds with the status codes in
+// sequence (the last one is repeated), redirecting to itself on 3xx.
+func newRobotsServer(robots string, robotsStatus ...int) (*httptest.Server, *int32) {
+	var cnt int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			n := int(atomic.AddInt32(&cnt, 1))
+			if n > len(robotsStatus) {
+				n = len(robotsStatus)
+			}
+			if st := robotsStatus[n-1]; st >= 300 && st < 400 {
+				http.Redirect(w, r, "/robots.txt", st)
+			} else {
+				w.WriteHeader(st)
+				w.Write([]byte(robots))
+			}
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a><a href="/b">b</a></body></html>`))
+		default:
+			w.Write([]byte("<html><body>ok</body></html>"))
+		}
+	}))
+	return srv, &cnt
+}
+
+func testRobotsServerError(t *testing.T, tc *testCase, buf bool) {
+	// Unreachable twice, then no robots.txt
+	srv, cnt := newRobotsServer("", http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusNotFound)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.RobotsRetryDelay = 50 * time.Millisecond
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	// The seed is kept until the robots.txt can be fetched
+	assertTrue(atomic.LoadInt32(cnt) == 3, "expected 3 robots.txt requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 3, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 0, t)
+	assertIsInLog(tc.name, spy.b, "robots.txt unreachable, postponing "+srv.URL+"/", t)
+}
+
+func testRobotsUnreachable(t *testing.T, tc *testCase, buf bool) {
+	srv, cnt := newRobotsServer("", http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.RobotsRetryDelay = 10 * time.Millisecond
+	opts.RobotsMaxAttempts = 3
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	// The seed is disallowed once the attempts are exhausted
+	assertTrue(atomic.LoadInt32(cnt) == 3, "expected 3 robots.txt requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 0, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 1, t)
+	assertTrue(c.Stats().Ignored["robots-unreachable"] == 1, "expected 1 URL ignored on unreachable robots.txt, got %v", c.Stats().Ignored)
+	assertIsInLog(tc.name, spy.b, "robots.txt unreachable for host "+srv.Listener.Addr().String()+" after 3 attempt(s), disallow all", t)
+}
+
+func testRobotsRedirects(t *testing.T, tc *testCase, buf bool) {
+	// Redirects forever, so the robots.txt is unavailable
+	srv, cnt := newRobotsServer("User-agent: *\nDisallow: /\n", http.StatusFound)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	// The request and 5 redirects
+	assertTrue(atomic.LoadInt32(cnt) == 6, "expected 6 robots.txt requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 3, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 0, t)
+}
+
+func testRobotsClientError(t *testing.T, tc *testCase, buf bool) {
+	srv, _ := newRobotsServer("User-agent: *\nDisallow: /\n", http.StatusForbidden)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	assertCallCount(spy, tc.name, eMKVisit, 3, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 0, t)
+}
+
+func testRobotsExpiry(t *testing.T, tc *testCase, buf bool) {
+	defer func(d time.Duration) { robotsMaxAge = d }(robotsMaxAge)
+	robotsMaxAge = 0
+
+	srv, cnt := newRobotsServer("User-agent: *\nDisallow: /b\n", http.StatusOK)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	// Once initially, then before each of the 3 URLs
+	assertTrue(atomic.LoadInt32(cnt) == 4, "expected 4 robots.txt requests, got %d", atomic.LoadInt32(cnt))
+	assertCallCount(spy, tc.name, eMKVisit, 2, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 1, t)
+	assertIsInLog(tc.name, spy.b, "robots.txt expired, fetching "+srv.URL+"/robots.txt", t)
+}
+
+func testRobotsMaxSize(t *testing.T, tc *testCase, buf bool) {
+	defer func(n int64) { robotsMaxSize = n }(robotsMaxSize)
+	robotsMaxSize = 40
+
+	// The second rule is beyond the size limit
+	srv, _ := newRobotsServer("User-agent: *\nDisallow: /a\n# padding...\nDisallow: /b\n", http.StatusOK)
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), buf)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	c.Run(srv.URL + "/")
+
+	assertCallCount(spy, tc.name, eMKVisit, 2, t)
+	assertCallCount(spy, tc.name, eMKDisallowed, 1, t)
+}
+
 // TODO : Test to assert low CPU usage during long crawl delay waits? (issue #12)
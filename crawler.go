@@ -2,9 +2,11 @@
 package gocrawl
 
 import (
-	"reflect"
+	"context"
+	"log/slog"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Communication from worker to the master crawler, about the crawling of a URL
@@ -14,6 +16,7 @@ type workerResponse struct {
 	harvestedURLs interface{}
 	host          string
 	idleDeath     bool
+	drained       []*URLContext
 }
 
 // Crawler is the web crawler that processes URLs and manages the workers.
@@ -21,20 +24,68 @@ type Crawler struct {
 	// Options configures the Crawler, refer to the Options type for documentation.
 	Options *Options
 
-	// Internal fields
+	// Internal fields. The mutex protects the fields that can be accessed
+	// from other goroutines via Enqueue and Stop. The enqueue mutex is read
+	// locked while Enqueue sends to the enqueue channel, and write locked
+	// to close it (see closeEnqueue).
+	mu              sync.Mutex
 	logFunc         func(LogFlags, string, ...interface{})
 	push            chan *workerResponse
 	enqueue         chan interface{}
-	stop            chan struct{}
+	enqueueMu       sync.RWMutex
+	enqueueClosed   bool
+	ctx             context.Context
+	stop            <-chan struct{}
+	cancel          context.CancelFunc
 	wg              *sync.WaitGroup
 	pushPopRefCount int
 	visits          int
 
-	// keep lookups in maps, O(1) access time vs O(n) for slice. The empty struct value
-	// is of no use, but this is the smallest type possible - it uses no memory at all.
-	visited map[string]struct{}
+	// Statistics of the crawl, shared by all workers
+	stats *crawlStats
+
+	// Pause gates of the crawl and of the hosts
+	pause      *pauseGate
+	hostPauses map[string]*pauseGate
+
+	// Graceful shutdown: the shutdown channel is closed by Shutdown, the
+	// drain channel is closed by the crawler to request the workers to hand
+	// their URLs back, and the done channel is closed when the crawl ends.
+	shutdown  chan struct{}
+	drain     chan struct{}
+	done      chan struct{}
+	draining  bool
+	drained   []*URLContext
+	unvisited []*URLContext
+
+	// Limits shared by all workers
+	slots   chan struct{}
+	limiter *rateLimiter
+
+	// Link extractors used by the workers, from Options.LinkExtractors
+	linkExtractors []LinkExtractor
+
+	// URLs scheduled for a revisit, if Options.RevisitPolicy is set
+	revisits revisitQueue
+
+	// keep lookups in maps, O(1) access time vs O(n) for slice. The visited map
+	// is the visit schedule of the URLs, the value is nil unless the URL is
+	// scheduled for a revisit (see Options.RevisitPolicy).
+	visited map[string]*visitSchedule
 	hosts   map[string]struct{}
 	workers map[string]*worker
+
+	// Hosts or registrable domains in scope, depending on Options.Scope
+	scopeHosts map[string]struct{}
+
+	// Declarative URL rules, from the Options
+	includeRules []*urlRule
+	excludeRules []*urlRule
+	seedPrefixes map[string][]string
+
+	// URLs stacked on a worker for which no response has been received yet,
+	// saved in the Frontier on checkpoints.
+	pending map[*URLContext]struct{}
 }
 
 // NewCrawlerWithOptions returns a Crawler initialized with the
@@ -58,24 +109,72 @@ func NewCrawler(ext Extender) *Crawler {
 // Options settings. Execution stops either when MaxVisits is reached (if specified)
 // or when no more URLs need visiting. If an error occurs, it is returned (if
 // MaxVisits is reached, the error ErrMaxVisits is returned).
+//
+// If Options.Store is set, the visited URLs and pending URLs saved in the
+// Store are restored before the seeds are enqueued, so that an interrupted
+// crawl resumes where it left off.
+//
+// Once Run returns, whatever the error, Stats returns the summary of the
+// crawl, with its End time set. The summary is also logged under LogInfo.
 func (c *Crawler) Run(seeds interface{}) error {
+	return c.RunContext(context.Background(), seeds)
+}
+
+// RunContext is like Run, but the crawling process also stops when the
+// provided context is cancelled or its deadline expires, in which case
+// the context's error is returned. Requests in progress are aborted, as the
+// context of each URL (see URLContext.Context) derives from this context.
+func (c *Crawler) RunContext(ctx context.Context, seeds interface{}) error {
 	// Helper log function, takes care of filtering based on level
-	c.logFunc = getLogFunc(c.Options.Extender, c.Options.LogFlags, -1)
+	c.logFunc = getLogFunc(c.Options.Extender, c.Options.Logger, c.Options.LogFlags, -1, "")
+
+	c.mu.Lock()
+	c.stats = newCrawlStats()
+	c.mu.Unlock()
+
+	// Fail early if a link extractor is not registered
+	les, err := lookupLinkExtractors(c.Options.LinkExtractors)
+	if err != nil {
+		return err
+	}
+	c.linkExtractors = les
+
+	// Fail early if a URL rule is invalid
+	if c.includeRules, err = compileURLRules(c.Options.IncludeRules); err != nil {
+		return err
+	}
+	if c.excludeRules, err = compileURLRules(c.Options.ExcludeRules); err != nil {
+		return err
+	}
 
 	seeds = c.Options.Extender.Start(seeds)
 	ctxs := c.toURLContexts(seeds, nil)
-	c.init(ctxs)
+	c.init(ctx, ctxs)
+	defer close(c.done)
+
+	// Resume from the saved frontier, if any
+	if err := c.restore(); err != nil {
+		c.reportError(newCrawlError(nil, err, CekStore))
+		c.logFunc(LogError, "ERROR loading checkpoint: %s", err, errAttr(err))
+		c.cancel()
+		c.endStats()
+		c.Options.Extender.End(err)
+		return err
+	}
 
 	// Start with the seeds, and loop till death
 	c.enqueueUrls(ctxs)
-	err := c.collectUrls()
+	err = c.collectUrls(ctx)
+	c.checkpoint()
+	c.saveUnvisited()
+	c.endStats()
 
 	c.Options.Extender.End(err)
 	return err
 }
 
 // Initialize the Crawler's internal fields before a crawling execution.
-func (c *Crawler) init(ctxs []*URLContext) {
+func (c *Crawler) init(ctx context.Context, ctxs []*URLContext) {
 	// Initialize the internal hosts map
 	c.hosts = make(map[string]struct{}, len(ctxs))
 	for _, ctx := range ctxs {
@@ -85,6 +184,9 @@ func (c *Crawler) init(ctxs []*URLContext) {
 		}
 	}
 
+	c.initScope(ctxs)
+	c.initSeedPrefixes(ctxs)
+
 	hostCount := len(c.hosts)
 	l := len(ctxs)
 	c.logFunc(LogTrace, "init() - seeds length: %d", l)
@@ -95,60 +197,50 @@ func (c *Crawler) init(ctxs []*URLContext) {
 	c.wg = new(sync.WaitGroup)
 
 	// Initialize the visits fields
-	c.visited = make(map[string]struct{}, l)
+	c.visited = make(map[string]*visitSchedule, l)
+	c.revisits = revisitQueue{}
+	c.pending = make(map[*URLContext]struct{}, l)
 	c.pushPopRefCount, c.visits = 0, 0
+	c.draining, c.drained = false, nil
 
 	// Create the workers map and the push channel (the channel used by workers
-	// to communicate back to the crawler)
-	c.stop = make(chan struct{})
-	if c.Options.SameHostOnly {
+	// to communicate back to the crawler). The stop channel is the done channel
+	// of the run context, so that workers stop on cancellation.
+	c.mu.Lock()
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.stop = c.ctx.Done()
+	c.enqueue = make(chan interface{}, c.Options.EnqueueChanBuffer)
+	c.enqueueMu.Lock()
+	c.enqueueClosed = false
+	c.enqueueMu.Unlock()
+	c.pause = new(pauseGate)
+	c.hostPauses = make(map[string]*pauseGate)
+	c.shutdown, c.drain, c.done = make(chan struct{}), make(chan struct{}), make(chan struct{})
+	c.unvisited = nil
+	c.mu.Unlock()
+	if c.Options.Scope == ScopeHostList {
+		hostCount = len(c.scopeHosts)
+	}
+	if (c.Options.Scope == ScopeDefault && c.Options.SameHostOnly) || c.Options.Scope == ScopeExactHost || c.Options.Scope == ScopeHostList {
 		c.workers, c.push = make(map[string]*worker, hostCount),
 			make(chan *workerResponse, hostCount)
 	} else {
 		c.workers, c.push = make(map[string]*worker, c.Options.HostBufferFactor*hostCount),
 			make(chan *workerResponse, c.Options.HostBufferFactor*hostCount)
 	}
-	// Create and pass the enqueue channel
-	c.enqueue = make(chan interface{}, c.Options.EnqueueChanBuffer)
-	c.setExtenderEnqueueChan()
-}
-
-// Set the Enqueue channel on the extender, based on the naming convention.
-func (c *Crawler) setExtenderEnqueueChan() {
-	defer func() {
-		if err := recover(); err != nil {
-			// Panic can happen if the field exists on a pointer struct, but that
-			// pointer is nil.
-			c.logFunc(LogError, "cannot set the enqueue channel: %s", err)
-		}
-	}()
-
-	// Using reflection, check if the extender has a `EnqueueChan` field
-	// of type `chan<- interface{}`. If it does, set it to the crawler's
-	// enqueue channel.
-	v := reflect.ValueOf(c.Options.Extender)
-	el := v.Elem()
-	if el.Kind() != reflect.Struct {
-		c.logFunc(LogInfo, "extender is not a struct, cannot set the enqueue channel")
-		return
-	}
-	ec := el.FieldByName("EnqueueChan")
-	if !ec.IsValid() {
-		c.logFunc(LogInfo, "extender.EnqueueChan does not exist, cannot set the enqueue channel")
-		return
+	// Create the global limits, if any
+	c.slots, c.limiter = nil, nil
+	if c.Options.MaxConcurrentHosts > 0 {
+		c.slots = make(chan struct{}, c.Options.MaxConcurrentHosts)
 	}
-	t := ec.Type()
-	if t.Kind() != reflect.Chan || t.ChanDir() != reflect.SendDir {
-		c.logFunc(LogInfo, "extender.EnqueueChan is not of type chan<-interface{}, cannot set the enqueue channel")
-		return
+	if c.Options.MaxRequestsPerSecond > 0 {
+		c.limiter = newRateLimiter(c.Options.MaxRequestsPerSecond)
 	}
-	tt := t.Elem()
-	if tt.Kind() != reflect.Interface || tt.NumMethod() != 0 {
-		c.logFunc(LogInfo, "extender.EnqueueChan is not of type chan<-interface{}, cannot set the enqueue channel")
-		return
+
+	// Pass the crawler as Enqueuer to the extender if it accepts it
+	if es, ok := extenderAs[EnqueuerSetter](c.Options.Extender); ok {
+		es.SetEnqueuer(c)
 	}
-	src := reflect.ValueOf(c.enqueue)
-	ec.Set(src)
 }
 
 // Launch a new worker goroutine for a given host.
@@ -159,15 +251,23 @@ func (c *Crawler) launchWorker(ctx *URLContext) *worker {
 
 	// Create the worker
 	w := &worker{
-		host:    ctx.normalizedURL.Host,
-		index:   i,
-		push:    c.push,
-		pop:     pop,
-		stop:    c.stop,
-		enqueue: c.enqueue,
-		wg:      c.wg,
-		logFunc: getLogFunc(c.Options.Extender, c.Options.LogFlags, i),
-		opts:    c.Options,
+		host:           ctx.normalizedURL.Host,
+		index:          i,
+		push:           c.push,
+		pop:            pop,
+		ctx:            c.ctx,
+		stop:           c.stop,
+		enqueue:        c.enqueue,
+		wg:             c.wg,
+		slots:          c.slots,
+		limiter:        c.limiter,
+		linkExtractors: c.linkExtractors,
+		stats:          c.stats,
+		drain:          c.drain,
+		pause:          c.pause,
+		hostPause:      c.hostPauseGate(ctx.normalizedURL.Host),
+		logFunc:        getLogFunc(c.Options.Extender, c.Options.Logger, c.Options.LogFlags, i, ctx.normalizedURL.Host),
+		opts:           c.Options,
 	}
 
 	// Increment wait group count
@@ -175,8 +275,9 @@ func (c *Crawler) launchWorker(ctx *URLContext) *worker {
 
 	// Launch worker
 	go w.run()
-	c.logFunc(LogInfo, "worker %d launched for host %s", i, w.host)
+	c.logFunc(LogInfo, "worker %d launched for host %s", i, w.host, slog.Int("worker", i), slog.String("host", w.host))
 	c.workers[w.host] = w
+	c.stats.update(func(s *Stats) { s.ActiveWorkers = len(c.workers) })
 
 	return w
 }
@@ -194,6 +295,51 @@ func (c *Crawler) isSameHost(ctx *URLContext) bool {
 	return ok
 }
 
+// Mark the canonical URL of the visited URL as visited, if it declared one
+// that differs from its normalized URL.
+func (c *Crawler) markCanonicalVisited(ctx *URLContext) {
+	if ctx.canonicalURL == nil {
+		return
+	}
+	key := ctx.canonicalURL.String()
+	if key == ctx.normalizedURL.String() {
+		return
+	}
+	if _, ok := c.visited[key]; !ok {
+		c.visited[key] = nil
+		c.logFunc(LogTrace, "canonical of %s: %s", ctx.normalizedURL, key, urlAttr(ctx.normalizedURL), slog.String("canonical", key))
+	}
+}
+
+// Stack the URL on the queue of its host's worker, launching the worker if
+// required.
+func (c *Crawler) stackURL(ctx *URLContext) {
+	// Launch worker if required, based on the host of the normalized URL
+	w, ok := c.workers[ctx.normalizedURL.Host]
+	if !ok {
+		// No worker exists for this host, launch a new one
+		w = c.launchWorker(ctx)
+		// Automatically enqueue the robots.txt URL as first in line
+		if robCtx, e := ctx.getRobotsURLCtx(); e != nil {
+			c.reportError(newCrawlError(ctx, e, CekParseRobots))
+			c.logFunc(LogError, "ERROR parsing robots.txt from %s: %s", ctx.normalizedURL, e, urlAttr(ctx.normalizedURL), errAttr(e))
+		} else {
+			c.logFunc(LogEnqueued, "enqueue: %s", robCtx.url, urlAttr(robCtx.url))
+			c.Options.Extender.Enqueued(robCtx)
+			w.pop.stack(robCtx)
+		}
+	}
+
+	c.logFunc(LogEnqueued, "enqueue: %s", ctx.url, urlAttr(ctx.url))
+	c.Options.Extender.Enqueued(ctx)
+	w.pop.stack(ctx)
+	c.stats.enqueue(ctx.normalizedURL.Host)
+	c.pushPopRefCount++
+	if !ctx.sitemap {
+		c.pending[ctx] = struct{}{}
+	}
+}
+
 // Enqueue the URLs returned from the worker, as long as it complies with the
 // selection policies.
 func (c *Crawler) enqueueUrls(ctxs []*URLContext) (cnt int) {
@@ -205,28 +351,57 @@ func (c *Crawler) enqueueUrls(ctxs []*URLContext) (cnt int) {
 		if ctx.IsRobotsURL() {
 			continue
 		}
+		// A sitemap of another host goes to the worker of its host, it is not
+		// a page to visit.
+		if ctx.sitemap {
+			if !c.draining {
+				c.stackURL(ctx)
+			}
+			continue
+		}
 		// Check if it has been visited before, using the normalized URL
 		_, isVisited = c.visited[ctx.normalizedURL.String()]
 
+		// Check the declarative rules before the Filter
+		if rule := c.checkURLRules(ctx); rule != "" {
+			c.stats.ignore("rule:" + rule)
+			c.logFunc(LogIgnored, "ignore on rule %s: %s", rule, ctx.normalizedURL, urlAttr(ctx.normalizedURL), slog.String("rule", rule))
+			continue
+		}
+
 		// Filter the URL
 		if enqueue = c.Options.Extender.Filter(ctx, isVisited); !enqueue {
 			// Filter said NOT to use this url, so continue with next
-			c.logFunc(LogIgnored, "ignore on filter policy: %s", ctx.normalizedURL)
+			c.stats.ignore("filter")
+			c.logFunc(LogIgnored, "ignore on filter policy: %s", ctx.normalizedURL, urlAttr(ctx.normalizedURL))
 			continue
 		}
 
 		// Even if filter said to use the URL, it still MUST be absolute, http(s)-prefixed,
-		// and comply with the same host policy if requested.
+		// and comply with the scope policy.
 		if !ctx.normalizedURL.IsAbs() {
 			// Only absolute URLs are processed, so ignore
-			c.logFunc(LogIgnored, "ignore on absolute policy: %s", ctx.normalizedURL)
+			c.stats.ignore("absolute")
+			c.logFunc(LogIgnored, "ignore on absolute policy: %s", ctx.normalizedURL, urlAttr(ctx.normalizedURL))
 
 		} else if !strings.HasPrefix(ctx.normalizedURL.Scheme, "http") {
-			c.logFunc(LogIgnored, "ignore on scheme policy: %s", ctx.normalizedURL)
+			c.stats.ignore("scheme")
+			c.logFunc(LogIgnored, "ignore on scheme policy: %s", ctx.normalizedURL, urlAttr(ctx.normalizedURL))
 
-		} else if c.Options.SameHostOnly && !c.isSameHost(ctx) {
+		} else if c.Options.Scope == ScopeDefault && c.Options.SameHostOnly && !c.isSameHost(ctx) {
 			// Only allow URLs coming from the same host
-			c.logFunc(LogIgnored, "ignore on same host policy: %s", ctx.normalizedURL)
+			c.stats.ignore("same-host")
+			c.logFunc(LogIgnored, "ignore on same host policy: %s", ctx.normalizedURL, urlAttr(ctx.normalizedURL))
+
+		} else if !c.isInScope(ctx) {
+			// Only allow URLs of the hosts in scope
+			c.stats.ignore("scope")
+			c.logFunc(LogIgnored, "ignore on scope policy (%s): %s", c.Options.Scope, ctx.normalizedURL, urlAttr(ctx.normalizedURL))
+
+		} else if c.Options.MaxDepth > 0 && ctx.depth > c.Options.MaxDepth {
+			// Only allow URLs close enough to a seed
+			c.stats.ignore("depth")
+			c.logFunc(LogIgnored, "ignore on depth policy: %s", ctx.normalizedURL, urlAttr(ctx.normalizedURL))
 
 		} else {
 			// All is good, visit this URL (robots.txt verification is done by worker)
@@ -238,34 +413,20 @@ func (c *Crawler) enqueueUrls(ctxs []*URLContext) (cnt int) {
 			// from www.site.com) and can be fixed by using a different normalization
 			// flag. So this is an acceptable behaviour for gocrawl.
 
-			// Launch worker if required, based on the host of the normalized URL
-			w, ok := c.workers[ctx.normalizedURL.Host]
-			if !ok {
-				// No worker exists for this host, launch a new one
-				w = c.launchWorker(ctx)
-				// Automatically enqueue the robots.txt URL as first in line
-				if robCtx, e := ctx.getRobotsURLCtx(); e != nil {
-					c.Options.Extender.Error(newCrawlError(ctx, e, CekParseRobots))
-					c.logFunc(LogError, "ERROR parsing robots.txt from %s: %s", ctx.normalizedURL, e)
-				} else {
-					c.logFunc(LogEnqueued, "enqueue: %s", robCtx.url)
-					c.Options.Extender.Enqueued(robCtx)
-					w.pop.stack(robCtx)
-				}
-			}
-
 			cnt++
-			c.logFunc(LogEnqueued, "enqueue: %s", ctx.url)
-			c.Options.Extender.Enqueued(ctx)
-			w.pop.stack(ctx)
-			c.pushPopRefCount++
+			if c.draining {
+				// Shutting down, keep it as not visited
+				c.drainURL(ctx)
+				continue
+			}
+			c.stackURL(ctx)
 
 			// Once it is stacked, it WILL be visited eventually, so add it to the visited slice
 			// (unless denied by robots.txt, but this is out of our hands, for all we
 			// care, it is visited).
 			if !isVisited {
 				// The visited map works with the normalized URL
-				c.visited[ctx.normalizedURL.String()] = struct{}{}
+				c.visited[ctx.normalizedURL.String()] = nil
 			}
 		}
 	}
@@ -274,68 +435,206 @@ func (c *Crawler) enqueueUrls(ctxs []*URLContext) (cnt int) {
 
 // This is the main loop of the crawler, waiting for responses from the workers
 // and processing these responses.
-func (c *Crawler) collectUrls() error {
+func (c *Crawler) collectUrls(ctx context.Context) error {
 	defer func() {
+		c.enqueueMu.Lock()
+		c.enqueueClosed = true
+		c.enqueueMu.Unlock()
 		c.logFunc(LogInfo, "waiting for goroutines to complete...")
 		c.wg.Wait()
 		c.logFunc(LogInfo, "crawler done.")
 	}()
 
+	var checkpointChan <-chan time.Time
+	if c.Options.Store != nil && c.Options.CheckpointInterval > 0 {
+		ticker := time.NewTicker(c.Options.CheckpointInterval)
+		defer ticker.Stop()
+		checkpointChan = ticker.C
+	}
+
+	var revisitTimer *time.Timer
+	shutdownChan := c.shutdown
 	for {
 		// By checking this after each channel reception, there is a bug if the worker
 		// wants to reenqueue following an error or a redirection. The pushPopRefCount
 		// temporarily gets to zero before the new URL is enqueued. Check the length
 		// of the enqueue channel to see if this is really over, or just this temporary
-		// state.
+		// state (see closeEnqueue).
 		//
 		// Check if refcount is zero - MUST be before the select statement, so that if
 		// no valid seeds are enqueued, the crawler stops.
-		if c.pushPopRefCount == 0 && len(c.enqueue) == 0 {
+		//
+		// URLs scheduled for a revisit keep the crawler running, unless it is
+		// shutting down.
+		if c.pushPopRefCount == 0 && (c.revisits.Len() == 0 || c.draining) && c.closeEnqueue() {
 			c.logFunc(LogInfo, "sending STOP signals...")
-			close(c.stop)
+			c.cancel()
+			if c.draining {
+				return ErrShutdown
+			}
 			return nil
 		}
 
+		var revisitChan <-chan time.Time
+		if d, ok := c.revisits.nextIn(time.Now()); ok && !c.draining {
+			if revisitTimer == nil {
+				revisitTimer = time.NewTimer(d)
+				defer revisitTimer.Stop()
+			} else {
+				if !revisitTimer.Stop() {
+					select {
+					case <-revisitTimer.C:
+					default:
+					}
+				}
+				revisitTimer.Reset(d)
+			}
+			revisitChan = revisitTimer.C
+		}
+
 		select {
 		case res := <-c.push:
 			// Received a response, check if it contains URLs to enqueue
+			if res.drained != nil {
+				// The worker handed its URLs back on shutdown
+				c.pushPopRefCount -= len(res.drained)
+				for _, ctx := range res.drained {
+					c.drainURL(ctx)
+					c.stats.done(res.host, false)
+				}
+			} else if res.idleDeath {
+				// The worker timed out from its Idle TTL delay, remove from active workers
+				delete(c.workers, res.host)
+				c.stats.update(func(s *Stats) { s.ActiveWorkers = len(c.workers) })
+				c.logFunc(LogInfo, "worker for host %s cleared on idle policy", res.host, slog.String("host", res.host))
+			} else {
+				if res.visited && c.Options.CanonicalIdentity {
+					c.markCanonicalVisited(res.ctx)
+				}
+				c.enqueueUrls(c.toURLContexts(res.harvestedURLs, res.ctx))
+				c.pushPopRefCount--
+				delete(c.pending, res.ctx)
+				c.stats.done(res.host, res.visited)
+				if c.Options.RevisitPolicy != nil {
+					if res.visited || res.ctx.notModified {
+						c.scheduleRevisit(res)
+					} else {
+						c.rescheduleRevisit(res)
+					}
+				}
+			}
+
+			// Check the visits limit once the response is processed, so that
+			// the visited URL is not saved as pending and its harvested URLs
+			// are.
 			if res.visited {
 				c.visits++
 				if c.Options.MaxVisits > 0 && c.visits >= c.Options.MaxVisits {
 					// Limit reached, request workers to stop
 					c.logFunc(LogInfo, "sending STOP signals...")
-					close(c.stop)
+					c.cancel()
 					return ErrMaxVisits
 				}
 			}
-			if res.idleDeath {
-				// The worker timed out from its Idle TTL delay, remove from active workers
-				delete(c.workers, res.host)
-				c.logFunc(LogInfo, "worker for host %s cleared on idle policy", res.host)
-			} else {
-				c.enqueueUrls(c.toURLContexts(res.harvestedURLs, res.ctx.url))
-				c.pushPopRefCount--
-			}
 
 		case enq := <-c.enqueue:
 			// Received a command to enqueue a URL, proceed
 			ctxs := c.toURLContexts(enq, nil)
 			c.logFunc(LogTrace, "receive url(s) to enqueue %v", toStringArrayContextURL(ctxs))
 			c.enqueueUrls(ctxs)
+		case <-shutdownChan:
+			// Shutdown was called, only once
+			shutdownChan = nil
+			c.startDrain()
+		case <-checkpointChan:
+			c.checkpoint()
+		case <-revisitChan:
+			c.stackRevisits(time.Now())
 		case <-c.stop:
+			// Either Stop was called or the parent context is done
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			return ErrInterrupted
 		}
 	}
 }
 
-// Stop terminates the crawler.
-func (c *Crawler) Stop() {
-	defer func() {
-		if err := recover(); err != nil {
-			c.logFunc(LogError, "error when manually stopping crawler: %s", err)
+// Enqueue enqueues the URLs in the running crawler, as if they had been
+// harvested from a visit: they go through the Filter and, if allowed, get
+// fetched and visited. Each value can be of any of the types supported for
+// the seeds. It is safe to call it from any goroutine, and it returns
+// ErrNotRunning if the crawler is not running or is shutting down (see
+// Shutdown), in which case the URLs that follow are not enqueued. Note that
+// it blocks if the enqueue buffer (see Options.EnqueueChanBuffer) is full.
+func (c *Crawler) Enqueue(urls ...interface{}) error {
+	c.mu.Lock()
+	enq, stop, shutdown := c.enqueue, c.stop, c.shutdown
+	c.mu.Unlock()
+
+	if stop == nil {
+		return ErrNotRunning
+	}
+	for _, u := range urls {
+		// Check for the stop and shutdown signals first, so that the URLs are
+		// not silently dropped in the buffer once the crawl has ended.
+		select {
+		case <-stop:
+			return ErrNotRunning
+		case <-shutdown:
+			return ErrNotRunning
+		default:
 		}
-	}()
 
-	// this channel may be closed already
-	close(c.stop)
+		if err := c.send(enq, stop, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send the URL to the enqueue channel under the enqueue read lock, so that
+// the crawler cannot end while the URL is being sent (see closeEnqueue).
+func (c *Crawler) send(enq chan<- interface{}, stop <-chan struct{}, u interface{}) error {
+	c.enqueueMu.RLock()
+	defer c.enqueueMu.RUnlock()
+
+	if c.enqueueClosed {
+		return ErrNotRunning
+	}
+	select {
+	case enq <- u:
+		return nil
+	case <-stop:
+		return ErrNotRunning
+	}
+}
+
+// Prevent URLs from being enqueued via Enqueue, unless URLs are waiting in
+// the enqueue buffer or are being sent to it. Returns true if the crawler
+// may end, with no URL left in the buffer.
+func (c *Crawler) closeEnqueue() bool {
+	// The lock is held by the senders, which wait for the crawler if the
+	// buffer is full, so it must not block.
+	if len(c.enqueue) > 0 || !c.enqueueMu.TryLock() {
+		return false
+	}
+	defer c.enqueueMu.Unlock()
+
+	if len(c.enqueue) > 0 {
+		return false
+	}
+	c.enqueueClosed = true
+	return true
+}
+
+// Stop terminates the crawler. It is safe to call it multiple times.
+func (c *Crawler) Stop() {
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
 }
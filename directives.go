@@ -0,0 +1,97 @@
+package gocrawl
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// RobotsDirectives holds the page-level robots directives of a visited URL,
+// from the robots meta tags and the X-Robots-Tag headers of the response.
+type RobotsDirectives struct {
+	// NoIndex indicates that the page should not be indexed.
+	NoIndex bool
+
+	// NoFollow indicates that the links of the page should not be followed.
+	// If Options.HonorRobotsDirectives is set, the crawler does not harvest
+	// the links of such a page.
+	NoFollow bool
+
+	// NoArchive indicates that the page should not be archived or cached.
+	NoArchive bool
+}
+
+var robotsMetaMatcher = cascadia.MustCompile("meta[name][content]")
+
+// Get the robots directives that apply to the robot user agent, from the
+// X-Robots-Tag headers and the robots meta tags (either the generic "robots"
+// name or the name of the robot, e.g. "googlebot").
+func getRobotsDirectives(robotAgent string, h http.Header, doc *goquery.Document) RobotsDirectives {
+	var rd RobotsDirectives
+
+	agent := robotAgentToken(robotAgent)
+	for _, v := range h.Values("X-Robots-Tag") {
+		// The value may be prefixed with the user agent it applies to, e.g.
+		// "googlebot: noindex". Directives may also contain a colon (e.g.
+		// "unavailable_after: <date>"), so only consider known agents.
+		if i := strings.Index(v, ":"); i >= 0 {
+			if prefix := strings.ToLower(strings.TrimSpace(v[:i])); prefix == agent {
+				v = v[i+1:]
+			} else if !strings.ContainsAny(prefix, " ,") && !isRobotsDirective(prefix) {
+				continue
+			}
+		}
+		rd.parse(v)
+	}
+
+	if doc != nil {
+		doc.FindMatcher(robotsMetaMatcher).Each(func(_ int, s *goquery.Selection) {
+			name, _ := s.Attr("name")
+			if name = strings.ToLower(strings.TrimSpace(name)); name == "robots" || name == agent {
+				content, _ := s.Attr("content")
+				rd.parse(content)
+			}
+		})
+	}
+	return rd
+}
+
+// Parse a comma-separated list of directives.
+func (rd *RobotsDirectives) parse(v string) {
+	for _, d := range strings.Split(v, ",") {
+		switch strings.ToLower(strings.TrimSpace(d)) {
+		case "none":
+			rd.NoIndex, rd.NoFollow = true, true
+		case "noindex":
+			rd.NoIndex = true
+		case "nofollow":
+			rd.NoFollow = true
+		case "noarchive":
+			rd.NoArchive = true
+		}
+	}
+}
+
+func isRobotsDirective(s string) bool {
+	switch s {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return true
+	}
+	return false
+}
+
+// Return the lowercase product token of the robot user agent, e.g.
+// "googlebot" for "Googlebot/2.1 (+http://www.google.com/bot.html)".
+func robotAgentToken(agent string) string {
+	if i := strings.IndexAny(agent, "/ ("); i >= 0 {
+		agent = agent[:i]
+	}
+	return strings.ToLower(agent)
+}
+
+// Indicates if the rel attribute value contains nofollow.
+func isNofollowRel(rel string) bool {
+	return hasRel(rel, "nofollow")
+}
@@ -0,0 +1,61 @@
+package gocrawl
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestRobotsDirectives(t *testing.T) {
+	cases := []struct {
+		header []string
+		meta   string
+		want   RobotsDirectives
+	}{
+		{nil, "", RobotsDirectives{}},
+		{nil, `<meta name="robots" content="noindex, NOFOLLOW">`, RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{nil, `<meta name="Googlebot" content="noarchive">`, RobotsDirectives{NoArchive: true}},
+		{nil, `<meta name="otherbot" content="none">`, RobotsDirectives{}},
+		{nil, `<meta name="robots" content="none">`, RobotsDirectives{NoIndex: true, NoFollow: true}},
+		{[]string{"nofollow"}, "", RobotsDirectives{NoFollow: true}},
+		{[]string{"googlebot: noindex", "otherbot: nofollow"}, "", RobotsDirectives{NoIndex: true}},
+		{[]string{"noarchive, unavailable_after: 25 Jun 2010 15:00:00 PST"}, "", RobotsDirectives{NoArchive: true}},
+	}
+	for i, c := range cases {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + c.meta + "</head></html>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := http.Header{"X-Robots-Tag": c.header}
+		if got := getRobotsDirectives(DefaultRobotUserAgent, h, doc); got != c.want {
+			t.Errorf("%d: want %+v, got %+v", i, c.want, got)
+		}
+	}
+}
+
+func TestProcessLinksNofollow(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(
+		`<html><body><a href="/a">a</a><a href="/b" rel="external nofollow">b</a></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Url, _ = url.Parse("http://host/")
+
+	les, _ := lookupLinkExtractors(nil)
+	w := &worker{linkExtractors: les, opts: &Options{}, logFunc: func(LogFlags, string, ...interface{}) {}}
+	if links := w.processLinks(&URLContext{}, doc); len(links) != 2 {
+		t.Errorf("expected 2 links when directives are not honoured, got %d", len(links))
+	}
+
+	w.opts.HonorRobotsDirectives = true
+	if links := w.processLinks(&URLContext{}, doc); len(links) != 1 || links[0].URL.Path != "/a" {
+		t.Errorf("expected only /a, got %v", links)
+	}
+	ctx := &URLContext{url: doc.Url, robots: RobotsDirectives{NoFollow: true}}
+	if links := w.processLinks(ctx, doc); len(links) != 0 {
+		t.Errorf("expected no link on a nofollow page, got %d", len(links))
+	}
+}
@@ -17,6 +17,15 @@ var (
 	// ErrInterrupted is returned when the crawler is manually stopped
 	// (via a call to Stop).
 	ErrInterrupted = errors.New("interrupted")
+
+	// ErrNotRunning is returned by Crawler.Enqueue when the crawler is not
+	// running (it has not started or it has ended), and by Crawler.Shutdown
+	// when it has not started.
+	ErrNotRunning = errors.New("crawler is not running")
+
+	// ErrShutdown is returned when the crawler is gracefully stopped (via a
+	// call to Shutdown).
+	ErrShutdown = errors.New("shut down")
 )
 
 // CrawlErrorKind indicated the kind of crawling error.
@@ -32,6 +41,9 @@ const (
 	CekParseURL
 	CekProcessLinks
 	CekParseRedirectURL
+	CekStore
+	CekParseSitemap
+	CekResponseSink
 )
 
 var (
@@ -44,6 +56,9 @@ var (
 		CekParseURL:         "ParseURL",
 		CekProcessLinks:     "ProcessLinks",
 		CekParseRedirectURL: "ParseRedirectURL",
+		CekStore:            "Store",
+		CekParseSitemap:     "ParseSitemap",
+		CekResponseSink:     "ResponseSink",
 	}
 )
 
@@ -1,30 +1,34 @@
 package gocrawl
 
 import (
-	"errors"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 // DelayInfo contains the delay configuration: the Options delay, the
-// Robots.txt delay, and the last delay used.
+// Robots.txt delay, the last delay used, and the Retry-After delay
+// requested by the host on the last fetch, if it was throttled.
 type DelayInfo struct {
 	OptsDelay   time.Duration
 	RobotsDelay time.Duration
 	LastDelay   time.Duration
+	RetryAfter  time.Duration
 }
 
 // FetchInfo contains the fetch information: the duration of the fetch,
 // the returned status code, whether or not it was a HEAD request,
-// and whether or not it was a robots.txt request.
+// and the delay requested by the Retry-After header of a 429 or 503
+// response.
 type FetchInfo struct {
 	Ctx           *URLContext
 	Duration      time.Duration
 	StatusCode    int
 	IsHeadRequest bool
+	RetryAfter    time.Duration
 }
 
 // Extender defines the extension methods required by the crawler.
@@ -53,17 +57,105 @@ type Extender interface {
 	Disallowed(*URLContext)
 }
 
+// Enqueuer is the interface to enqueue URLs in a running crawler, it is
+// implemented by Crawler. See Crawler.Enqueue for details.
+type Enqueuer interface {
+	Enqueue(urls ...interface{}) error
+}
+
+// EnqueuerSetter can be implemented by an Extender to receive the Enqueuer
+// of the crawler, so that it can enqueue URLs at any time during the crawl.
+// SetEnqueuer is called by the crawler when Run starts.
+type EnqueuerSetter interface {
+	SetEnqueuer(Enqueuer)
+}
+
+// Retrier can be implemented by an Extender to control the retry of failed
+// fetches, overriding Options.RetryPolicy. Retry is called when the fetch
+// of the URL failed with the error, or with a non-2xx response (in which case
+// err is nil), with the number of failed attempts so far. It returns the
+// delay to wait before the next attempt, and true if the URL should be
+// fetched again.
+type Retrier interface {
+	Retry(ctx *URLContext, res *http.Response, err error, attempt int) (time.Duration, bool)
+}
+
+// ResponseSink receives the raw responses returned by Extender.Fetch, before
+// they are consumed by the crawler (see Options.ResponseSink). This includes
+// the robots.txt, sitemap and HEAD responses, and the non-2xx responses. The
+// body has already been read, and is passed as a byte slice. WriteResponse
+// is called concurrently by the workers of the various hosts.
+type ResponseSink interface {
+	WriteResponse(fi *FetchInfo, res *http.Response, body []byte) error
+}
+
+// SitemapRequester can be implemented by an Extender to control which
+// sitemaps are fetched when Options.FetchSitemaps is set. RequestSitemap is
+// called before fetching the sitemap (or sitemap index), and the sitemap is
+// skipped if it returns false.
+type SitemapRequester interface {
+	RequestSitemap(ctx *URLContext) bool
+}
+
+// NotModifiedVisitor can be implemented by an Extender to be notified when
+// the fetch of an URL returns a 304 Not Modified status code (e.g. following
+// a conditional request, see DefaultExtender.ValidatorStore). NotModified is
+// called instead of Visit, and the URL is not reported as an error. Like
+// Visit, it returns the URLs to enqueue (e.g. the links saved on the last
+// visit), and whether gocrawl should find the links itself. Since a 304
+// response has no body, gocrawl then fetches the URL again without the
+// conditional headers and visits it.
+type NotModifiedVisitor interface {
+	NotModified(ctx *URLContext, res *http.Response) (harvested interface{}, findLinks bool)
+}
+
+// DuplicateVisitor can be implemented by an Extender to be notified when the
+// content of an URL is a duplicate of an already visited URL, the original
+// (see Options.DuplicateDetector). Exact is true if the body is identical,
+// and false for a near duplicate. Duplicate returns true to visit the URL
+// anyway, otherwise it is skipped: Visit is not called and its links are not
+// harvested.
+type DuplicateVisitor interface {
+	Duplicate(ctx *URLContext, original *url.URL, exact bool) bool
+}
+
+// ExtenderWrapper can be implemented by an Extender that wraps another
+// Extender (e.g. to collect metrics), so that the optional interfaces
+// implemented by the wrapped Extender (Retrier, EnqueuerSetter, etc.) are
+// still used by the crawler. Unwrap returns the wrapped Extender.
+type ExtenderWrapper interface {
+	Unwrap() Extender
+}
+
+// Find the optional interface T implemented by the Extender, or by one of
+// the Extenders it wraps.
+func extenderAs[T any](ext Extender) (T, bool) {
+	for ext != nil {
+		if t, ok := ext.(T); ok {
+			return t, true
+		}
+		w, ok := ext.(ExtenderWrapper)
+		if !ok {
+			break
+		}
+		ext = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
 // HttpClient is the default HTTP client used by DefaultExtender's fetch
 // requests (this is thread-safe). The client's fields can be customized
 // (i.e. for a different redirection strategy, a different Transport
 // object, ...). It should be done prior to starting the crawler.
 var HttpClient = &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
-	// For robots.txt URLs, allow up to 10 redirects, like the default http client.
-	// Rationale: the site owner explicitly tells us that this specific robots.txt
-	// should be used for this domain.
+	// For robots.txt URLs, follow up to 5 redirects, as per RFC 9309. Rationale:
+	// the site owner explicitly tells us that this specific robots.txt should be
+	// used for this domain. After that, the last response is returned, and the
+	// robots.txt is considered unavailable.
 	if isRobotsURL(req.URL) {
-		if len(via) >= 10 {
-			return errors.New("stopped after 10 redirects")
+		if len(via) > 5 {
+			return http.ErrUseLastResponse
 		}
 		if len(via) > 0 {
 			req.Header.Set("User-Agent", via[0].Header.Get("User-Agent"))
@@ -81,7 +173,25 @@ var HttpClient = &http.Client{CheckRedirect: func(req *http.Request, via []*http
 // possible to nest such a value in a custom struct so that only the
 // Extender methods that require custom behaviour have to be implemented.
 type DefaultExtender struct {
-	EnqueueChan chan<- interface{}
+	// Enqueuer is set by the crawler when Run starts, it can be used to
+	// enqueue URLs at any time during the crawl.
+	Enqueuer Enqueuer
+
+	// RobotsCache, if set, caches the robots.txt content fetched from the
+	// hosts, so that it is not requested again while the cached content is
+	// fresh (based on the HTTP cache headers, for at most 24 hours).
+	RobotsCache RobotsCache
+
+	// ValidatorStore, if set, saves the ETag and Last-Modified validators of
+	// the fetched URLs, and Fetch uses them to make conditional requests,
+	// so that unchanged pages are not downloaded again (see the
+	// NotModifiedVisitor interface).
+	ValidatorStore ValidatorStore
+}
+
+// SetEnqueuer implements EnqueuerSetter, it sets the Enqueuer field.
+func (de *DefaultExtender) SetEnqueuer(e Enqueuer) {
+	de.Enqueuer = e
 }
 
 // Start returns the same seeds as those received (those that were passed
@@ -106,11 +216,30 @@ func (de *DefaultExtender) Log(logFlags LogFlags, msgLevel LogFlags, msg string)
 
 // ComputeDelay returns the delay specified in the Crawler's Options, unless a
 // crawl-delay is specified in the robots.txt file, which has precedence.
+// If the host throttled the last fetch (429 status code, or 503 with a
+// Retry-After header), the last delay is doubled (and is at least the
+// Retry-After delay), and it then gets halved on each fetch until it is back
+// to the normal delay.
 func (de *DefaultExtender) ComputeDelay(host string, di *DelayInfo, lastFetch *FetchInfo) time.Duration {
+	delay := di.OptsDelay
 	if di.RobotsDelay > 0 {
-		return di.RobotsDelay
+		delay = di.RobotsDelay
+	}
+
+	if lastFetch != nil && (lastFetch.StatusCode == http.StatusTooManyRequests || lastFetch.RetryAfter > 0) {
+		// Slow down
+		slow := 2 * di.LastDelay
+		if slow < di.RetryAfter {
+			slow = di.RetryAfter
+		}
+		if slow > delay {
+			return slow
+		}
+	} else if di.LastDelay/2 > delay {
+		// Recover progressively from a slow down
+		return di.LastDelay / 2
 	}
-	return di.OptsDelay
+	return delay
 }
 
 // Fetch requests the specified URL using the given user agent string. It uses
@@ -146,12 +275,22 @@ func (de *DefaultExtender) Fetch(ctx *URLContext, userAgent string, headRequest
 	} else {
 		reqType = "GET"
 	}
-	req, e := http.NewRequest(reqType, ctx.url.String(), nil)
+	req, e := http.NewRequestWithContext(ctx.Context(), reqType, ctx.url.String(), nil)
 	if e != nil {
 		return nil, e
 	}
 	req.Header.Set("User-Agent", userAgent)
-	return HttpClient.Do(req)
+
+	// Conditional requests, if the validators are known
+	conditional := de.ValidatorStore != nil && !headRequest && !ctx.IsRobotsURL() && !ctx.IsSitemapURL()
+	if conditional && !ctx.unconditional {
+		setConditionalHeaders(de.ValidatorStore, ctx, req)
+	}
+	res, e := HttpClient.Do(req)
+	if e == nil && conditional {
+		saveValidators(de.ValidatorStore, ctx, res)
+	}
+	return res, e
 }
 
 // RequestGet asks the worker to actually request the URL's body
@@ -160,13 +299,24 @@ func (de *DefaultExtender) RequestGet(ctx *URLContext, headRes *http.Response) b
 	return headRes.StatusCode >= 200 && headRes.StatusCode < 300
 }
 
-// RequestRobots asks the worker to actually request (fetch) the robots.txt.
+// RequestRobots asks the worker to actually request (fetch) the robots.txt,
+// unless it is found in the RobotsCache.
 func (de *DefaultExtender) RequestRobots(ctx *URLContext, robotAgent string) (data []byte, doRequest bool) {
+	if de.RobotsCache != nil {
+		if data, ok := de.RobotsCache.Get(ctx.normalizedURL.String()); ok {
+			return data, false
+		}
+	}
 	return nil, true
 }
 
-// FetchedRobots is a no-op.
-func (de *DefaultExtender) FetchedRobots(ctx *URLContext, res *http.Response) {}
+// FetchedRobots saves the robots.txt in the RobotsCache, if one is set.
+// Otherwise it is a no-op.
+func (de *DefaultExtender) FetchedRobots(ctx *URLContext, res *http.Response) {
+	if de.RobotsCache != nil {
+		cacheRobotsResponse(de.RobotsCache, ctx, res)
+	}
+}
 
 // Filter enqueues the URL if it hasn't been visited yet.
 func (de *DefaultExtender) Filter(ctx *URLContext, isVisited bool) bool {
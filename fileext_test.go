@@ -1,6 +1,7 @@
 package gocrawl
 
 import (
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
@@ -44,6 +45,12 @@ func (x *fileFetcherExtender) Fetch(ctx *URLContext, userAgent string, headReque
 		// Treat errors as 404s - file not found
 		res.Status = "404 Not Found"
 		res.StatusCode = 404
+		res.Body = ioutil.NopCloser(strings.NewReader(""))
+		if ctx.IsRobotsURL() {
+			// A missing robots.txt is a plain 404, not a fetch error (which
+			// would disallow the whole host)
+			e = nil
+		}
 	} else {
 		res.Status = "200 OK"
 		res.StatusCode = 200
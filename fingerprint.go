@@ -0,0 +1,212 @@
+package gocrawl
+
+import (
+	"crypto/sha256"
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// DefaultNearDuplicateDistance is the default maximum Hamming distance
+	// between the SimHash fingerprints of near-duplicate documents.
+	DefaultNearDuplicateDistance = 3
+
+	// Number of words in the shingles of the SimHash.
+	simhashShingleSize = 3
+
+	// The SimHash fingerprints are indexed by 16-bit bands, so that near
+	// duplicates within a distance of 3 share at least one band.
+	simhashBands = 4
+)
+
+// DuplicateDetector detects the documents with duplicate content, using the
+// SHA-256 hash of the body for exact duplicates, and the SimHash of the text
+// for near duplicates (e.g. the same page with a different timestamp or
+// session id). It is safe for concurrent use, so it can be shared by
+// multiple crawlers. See Options.DuplicateDetector.
+type DuplicateDetector struct {
+	// MaxDistance is the maximum Hamming distance between the SimHash
+	// fingerprints of near-duplicate documents. If zero, near duplicates
+	// are not detected. NewDuplicateDetector sets it to
+	// DefaultNearDuplicateDistance.
+	MaxDistance int
+
+	mu     sync.Mutex
+	exact  map[[sha256.Size]byte]*url.URL
+	simIdx [simhashBands]map[uint16][]*simEntry
+	sims   []*simEntry
+	byURL  map[string]*urlPrints
+}
+
+type simEntry struct {
+	hash uint64
+	u    *url.URL
+}
+
+// The fingerprints recorded for a URL, so that they can be replaced when
+// the URL is checked again (e.g. on a revisit).
+type urlPrints struct {
+	sum *[sha256.Size]byte
+	sim *simEntry
+}
+
+// NewDuplicateDetector returns a DuplicateDetector that detects exact and
+// near duplicates.
+func NewDuplicateDetector() *DuplicateDetector {
+	return &DuplicateDetector{MaxDistance: DefaultNearDuplicateDistance}
+}
+
+// Check returns the URL of the original document if the content is a
+// duplicate of a document already checked, and whether it is an exact
+// duplicate, the fingerprints of a duplicate are not recorded. Otherwise, it
+// records the fingerprints of the content for the URL, and returns a nil
+// URL. The text is the text content of the document,
+// used for the near-duplicate detection. If the URL was already checked, its
+// previous fingerprints are replaced, so that a revisited document is not a
+// duplicate of itself.
+func (d *DuplicateDetector) Check(u *url.URL, body []byte, text string) (original *url.URL, exact bool) {
+	sum := sha256.Sum256(body)
+	sim, ok := simhash(text)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.exact == nil {
+		d.exact = make(map[[sha256.Size]byte]*url.URL)
+		d.byURL = make(map[string]*urlPrints)
+	}
+	key := u.String()
+	d.remove(key)
+	if orig, found := d.exact[sum]; found {
+		return orig, true
+	}
+	near := ok && d.MaxDistance > 0
+	if near {
+		if orig := d.findNear(sim); orig != nil {
+			return orig, false
+		}
+	}
+
+	// Not a duplicate, record its fingerprints
+	d.exact[sum] = u
+	prints := &urlPrints{sum: &sum}
+	d.byURL[key] = prints
+	if near {
+		prints.sim = &simEntry{sim, u}
+		d.addSim(prints.sim)
+	}
+	return nil, false
+}
+
+// Remove the fingerprints recorded for the URL, if any.
+func (d *DuplicateDetector) remove(key string) {
+	prints, ok := d.byURL[key]
+	if !ok {
+		return
+	}
+	delete(d.byURL, key)
+	if orig, found := d.exact[*prints.sum]; found && orig.String() == key {
+		delete(d.exact, *prints.sum)
+	}
+	if prints.sim == nil {
+		return
+	}
+	d.sims = removeSim(d.sims, prints.sim)
+	for i := range d.simIdx {
+		b := band(prints.sim.hash, i)
+		if d.simIdx[i][b] = removeSim(d.simIdx[i][b], prints.sim); len(d.simIdx[i][b]) == 0 {
+			delete(d.simIdx[i], b)
+		}
+	}
+}
+
+func removeSim(entries []*simEntry, e *simEntry) []*simEntry {
+	for i, v := range entries {
+		if v == e {
+			return append(entries[:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// Find a recorded fingerprint within MaxDistance of the hash.
+func (d *DuplicateDetector) findNear(h uint64) *url.URL {
+	if d.MaxDistance >= simhashBands {
+		// The bands are not enough to find all candidates
+		for _, e := range d.sims {
+			if bits.OnesCount64(e.hash^h) <= d.MaxDistance {
+				return e.u
+			}
+		}
+		return nil
+	}
+	for i := range d.simIdx {
+		for _, e := range d.simIdx[i][band(h, i)] {
+			if bits.OnesCount64(e.hash^h) <= d.MaxDistance {
+				return e.u
+			}
+		}
+	}
+	return nil
+}
+
+func (d *DuplicateDetector) addSim(e *simEntry) {
+	d.sims = append(d.sims, e)
+	for i := range d.simIdx {
+		if d.simIdx[i] == nil {
+			d.simIdx[i] = make(map[uint16][]*simEntry)
+		}
+		b := band(e.hash, i)
+		d.simIdx[i][b] = append(d.simIdx[i][b], e)
+	}
+}
+
+func band(h uint64, i int) uint16 {
+	return uint16(h >> (16 * uint(i)))
+}
+
+// Compute the 64-bit SimHash of the text, using shingles of words. It
+// returns false if the text has no word.
+func simhash(text string) (uint64, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0, false
+	}
+
+	var v [64]int
+	n := len(words) - simhashShingleSize + 1
+	if n < 1 {
+		n = 1
+	}
+	h := fnv.New64a()
+	for i := 0; i < n; i++ {
+		end := i + simhashShingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+		h.Reset()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sh := h.Sum64()
+		for b := 0; b < 64; b++ {
+			if sh&(1<<uint(b)) != 0 {
+				v[b]++
+			} else {
+				v[b]--
+			}
+		}
+	}
+
+	var res uint64
+	for b := 0; b < 64; b++ {
+		if v[b] > 0 {
+			res |= 1 << uint(b)
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,159 @@
+package gocrawl
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A page-sized text, so that a single changed word makes a near duplicate.
+var dupText = func() string {
+	var buf bytes.Buffer
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&buf, "Paragraph %d of the quick brown fox that jumps over the lazy dog.\n", i)
+	}
+	return buf.String()
+}()
+
+func TestDuplicateDetector(t *testing.T) {
+	d := NewDuplicateDetector()
+	u1, _ := url.Parse("http://host/a")
+	u2, _ := url.Parse("http://host/b")
+	u3, _ := url.Parse("http://host/c")
+	u4, _ := url.Parse("http://host/d")
+
+	if orig, _ := d.Check(u1, []byte(dupText), dupText); orig != nil {
+		t.Fatalf("expected no original, got %s", orig)
+	}
+	if orig, exact := d.Check(u2, []byte(dupText), dupText); orig != u1 || !exact {
+		t.Errorf("expected exact duplicate of %s, got %v, %v", u1, orig, exact)
+	}
+	near := strings.Replace(dupText, "lazy", "sleepy", 1)
+	if orig, exact := d.Check(u3, []byte(near), near); orig != u1 || exact {
+		t.Errorf("expected near duplicate of %s, got %v, %v", u1, orig, exact)
+	}
+	// The near duplicate is not recorded, an exact copy of it is a near
+	// duplicate of the original
+	if orig, exact := d.Check(u4, []byte(near), near); orig != u1 || exact {
+		t.Errorf("expected near duplicate of %s, got %v, %v", u1, orig, exact)
+	}
+	other := "Lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua"
+	if orig, _ := d.Check(u4, []byte(other), other); orig != nil {
+		t.Errorf("expected no original, got %s", orig)
+	}
+}
+
+func TestDuplicateDetectorExactOnly(t *testing.T) {
+	d := &DuplicateDetector{}
+	u1, _ := url.Parse("http://host/a")
+	u2, _ := url.Parse("http://host/b")
+
+	d.Check(u1, []byte(dupText), dupText)
+	near := strings.Replace(dupText, "lazy", "sleepy", 1)
+	if orig, _ := d.Check(u2, []byte(near), near); orig != nil {
+		t.Errorf("expected no original, got %s", orig)
+	}
+}
+
+func TestDuplicateDetectorRecheck(t *testing.T) {
+	d := NewDuplicateDetector()
+	u1, _ := url.Parse("http://host/a")
+	u2, _ := url.Parse("http://host/b")
+
+	d.Check(u1, []byte(dupText), dupText)
+	// The same URL is not a duplicate of itself, with the same or near content
+	if orig, _ := d.Check(u1, []byte(dupText), dupText); orig != nil {
+		t.Errorf("expected no original on recheck, got %s", orig)
+	}
+	near := strings.Replace(dupText, "lazy", "sleepy", 1)
+	if orig, _ := d.Check(u1, []byte(near), near); orig != nil {
+		t.Errorf("expected no original on near recheck, got %s", orig)
+	}
+	// The old fingerprints are replaced by the new ones
+	if orig, _ := d.Check(u2, []byte(dupText), dupText); orig != u1 {
+		t.Errorf("expected near duplicate of %s, got %v", u1, orig)
+	}
+	if orig, exact := d.Check(u2, []byte(near), near); orig != u1 || !exact {
+		t.Errorf("expected exact duplicate of %s, got %v, %v", u1, orig, exact)
+	}
+	if len(d.sims) != 1 || len(d.byURL) != 1 {
+		t.Errorf("expected 1 recorded URL, got %d sims, %d URLs", len(d.sims), len(d.byURL))
+	}
+}
+
+func TestSimhashDistance(t *testing.T) {
+	h1, _ := simhash(dupText)
+	h2, _ := simhash(strings.Replace(dupText, "lazy", "sleepy", 1))
+	h3, _ := simhash("Lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor")
+	if d := bits.OnesCount64(h1 ^ h2); d > DefaultNearDuplicateDistance {
+		t.Errorf("expected near hashes, got a distance of %d", d)
+	}
+	if d := bits.OnesCount64(h1 ^ h3); d <= DefaultNearDuplicateDistance {
+		t.Errorf("expected distinct hashes, got a distance of %d", d)
+	}
+	if _, ok := simhash(" \n, "); ok {
+		t.Error("expected no hash for a text without words")
+	}
+}
+
+type duplicateExtender struct {
+	*spyExtender
+	visit bool
+
+	mu   sync.Mutex
+	dups map[string]string
+}
+
+func (x *duplicateExtender) Duplicate(ctx *URLContext, original *url.URL, exact bool) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.dups[ctx.URL().Path] = original.Path
+	return x.visit
+}
+
+func TestDuplicateContent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/b">b</a></body></html>`))
+		case "/a", "/b":
+			w.Write([]byte(`<html><body><p>` + dupText + `</p><a href="/c">c</a></body></html>`))
+		case "/c":
+			w.Write([]byte(`<html><body>c</body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, visit := range []bool{false, true} {
+		x := &duplicateExtender{spyExtender: newSpy(new(DefaultExtender), true), visit: visit, dups: make(map[string]string)}
+		opts := NewOptions(x)
+		opts.CrawlDelay = 0
+		opts.LogFlags = LogAll
+		opts.SameHostOnly = true
+		opts.DuplicateDetector = NewDuplicateDetector()
+		c := NewCrawlerWithOptions(opts)
+		c.Run([]string{srv.URL + "/", srv.URL + "/b"})
+
+		// Either /a or /b is the duplicate, depending on the fetch order
+		if len(x.dups) != 1 || (x.dups["/a"] != "/b" && x.dups["/b"] != "/a") {
+			t.Errorf("visit=%v: unexpected duplicates %v", visit, x.dups)
+		}
+		wantVisits := 3
+		if visit {
+			wantVisits = 4
+		}
+		assertCallCount(x.spyExtender, "DuplicateContent", eMKVisit, wantVisits, t)
+		assertCallCount(x.spyExtender, "DuplicateContent", eMKVisited, wantVisits, t)
+		if !visit {
+			assertIsInLog("DuplicateContent", x.b, "ignore on duplicate content policy: "+srv.URL, t)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 module github.com/PuerkitoBio/gocrawl
 
-go 1.16
+go 1.21
 
 require (
 	github.com/PuerkitoBio/goquery v1.6.1
 	github.com/PuerkitoBio/purell v1.1.1
-	github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
 	github.com/andybalholm/cascadia v1.2.0
 	github.com/temoto/robotstxt v1.1.2
 	golang.org/x/net v0.0.0-20210510120150-4163338589ed
 )
+
+require (
+	github.com/PuerkitoBio/urlesc v0.0.0-20170810143723-de5bf2ad4578 // indirect
+	golang.org/x/text v0.3.6 // indirect
+)
@@ -0,0 +1,34 @@
+package gocrawl
+
+import (
+	"sync"
+	"time"
+)
+
+// The rate limiter spaces out the requests of all workers so that the
+// global number of requests per second is not exceeded.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Create a rate limiter for the specified number of requests per second.
+func newRateLimiter(rps float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Reserve the next request slot and return the delay to wait before
+// making the request.
+func (rl *rateLimiter) reserve() time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	d := rl.next.Sub(now)
+	rl.next = rl.next.Add(rl.interval)
+	return d
+}
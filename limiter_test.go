@@ -0,0 +1,20 @@
+package gocrawl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(10)
+	if d := rl.reserve(); d != 0 {
+		t.Errorf("want no delay for the first request, got %v", d)
+	}
+	for i := 1; i < 5; i++ {
+		want := time.Duration(i) * 100 * time.Millisecond
+		// Allow some slack for the time elapsed between reservations
+		if d := rl.reserve(); d > want || d < want-10*time.Millisecond {
+			t.Errorf("%d: want delay of ~%v, got %v", i, want, d)
+		}
+	}
+}
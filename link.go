@@ -0,0 +1,201 @@
+package gocrawl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// Link is a link found in a document by a LinkExtractor. The extractor sets
+// the raw value of the link and where it was found, and the crawler resolves
+// the URL (taking the base tag into account).
+type Link struct {
+	// URL is the absolute URL of the link, set by the crawler.
+	URL *url.URL
+
+	// Value is the raw link, as found in the document.
+	Value string
+
+	// Tag and Attr are the element and attribute that contain the link,
+	// e.g. "a" and "href".
+	Tag  string
+	Attr string
+
+	// Rel is the value of the rel attribute of the element, if any.
+	Rel string
+}
+
+// LinkExtractor finds the links in a document.
+type LinkExtractor interface {
+	ExtractLinks(doc *goquery.Document) []*Link
+}
+
+// Return the resolved URLs of the links.
+func linkURLs(links []*Link) []*url.URL {
+	if links == nil {
+		return nil
+	}
+	urls := make([]*url.URL, len(links))
+	for i, l := range links {
+		urls[i] = l.URL
+	}
+	return urls
+}
+
+// LinkExtractorFunc is a function type that implements the LinkExtractor
+// interface.
+type LinkExtractorFunc func(doc *goquery.Document) []*Link
+
+// ExtractLinks calls f(doc).
+func (f LinkExtractorFunc) ExtractLinks(doc *goquery.Document) []*Link {
+	return f(doc)
+}
+
+var (
+	linkExtractorsMu sync.RWMutex
+	linkExtractors   = map[string]LinkExtractor{
+		"a":            attrExtractor("a[href]", "href"),
+		"area":         attrExtractor("area[href]", "href"),
+		"link":         LinkExtractorFunc(extractLinkRel),
+		"iframe":       attrExtractor("iframe[src]", "src"),
+		"frame":        attrExtractor("frame[src]", "src"),
+		"srcset":       LinkExtractorFunc(extractSrcset),
+		"meta-refresh": LinkExtractorFunc(extractMetaRefresh),
+		"form":         LinkExtractorFunc(extractFormAction),
+	}
+)
+
+// RegisterLinkExtractor makes a LinkExtractor available by the provided name
+// in Options.LinkExtractors. It panics if the name is already registered or
+// if the extractor is nil.
+//
+// The built-in extractors are:
+//
+//	"a"            : a[href]
+//	"area"         : area[href]
+//	"link"         : link[href] with a rel of next, prev, previous or alternate
+//	"iframe"       : iframe[src]
+//	"frame"        : frame[src]
+//	"srcset"       : the candidate URLs of img[srcset] and source[srcset]
+//	"meta-refresh" : the URL of meta[http-equiv=refresh]
+//	"form"         : form[action], for forms using the GET method
+func RegisterLinkExtractor(name string, le LinkExtractor) {
+	linkExtractorsMu.Lock()
+	defer linkExtractorsMu.Unlock()
+
+	if le == nil {
+		panic("gocrawl: RegisterLinkExtractor extractor is nil")
+	}
+	if _, dup := linkExtractors[name]; dup {
+		panic("gocrawl: RegisterLinkExtractor called twice for extractor " + name)
+	}
+	linkExtractors[name] = le
+}
+
+// Get the registered extractors for the provided names, or the "a" extractor
+// if names is nil.
+func lookupLinkExtractors(names []string) ([]LinkExtractor, error) {
+	linkExtractorsMu.RLock()
+	defer linkExtractorsMu.RUnlock()
+
+	if names == nil {
+		names = []string{"a"}
+	}
+	res := make([]LinkExtractor, 0, len(names))
+	for _, nm := range names {
+		le, ok := linkExtractors[nm]
+		if !ok {
+			return nil, fmt.Errorf("unknown link extractor: %s", nm)
+		}
+		res = append(res, le)
+	}
+	return res, nil
+}
+
+// Return an extractor of the specified attribute of the elements matching
+// the selector.
+func attrExtractor(sel, attr string) LinkExtractor {
+	m := cascadia.MustCompile(sel)
+	return LinkExtractorFunc(func(doc *goquery.Document) (links []*Link) {
+		doc.FindMatcher(m).Each(func(_ int, s *goquery.Selection) {
+			val, _ := s.Attr(attr)
+			rel, _ := s.Attr("rel")
+			links = append(links, &Link{Value: val, Tag: goquery.NodeName(s), Attr: attr, Rel: rel})
+		})
+		return links
+	})
+}
+
+var (
+	linkRelMatcher     = cascadia.MustCompile("link[href][rel]")
+	srcsetMatcher      = cascadia.MustCompile("img[srcset], source[srcset]")
+	metaRefreshMatcher = cascadia.MustCompile("meta[http-equiv][content]")
+	formActionMatcher  = cascadia.MustCompile("form[action]")
+)
+
+func extractLinkRel(doc *goquery.Document) (links []*Link) {
+	doc.FindMatcher(linkRelMatcher).Each(func(_ int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		for _, r := range strings.Fields(strings.ToLower(rel)) {
+			if r == "next" || r == "prev" || r == "previous" || r == "alternate" {
+				val, _ := s.Attr("href")
+				links = append(links, &Link{Value: val, Tag: "link", Attr: "href", Rel: rel})
+				return
+			}
+		}
+	})
+	return links
+}
+
+func extractSrcset(doc *goquery.Document) (links []*Link) {
+	doc.FindMatcher(srcsetMatcher).Each(func(_ int, s *goquery.Selection) {
+		val, _ := s.Attr("srcset")
+		for _, cand := range strings.Split(val, ",") {
+			// Each candidate is an URL followed by an optional descriptor
+			if f := strings.Fields(cand); len(f) > 0 {
+				links = append(links, &Link{Value: f[0], Tag: goquery.NodeName(s), Attr: "srcset"})
+			}
+		}
+	})
+	return links
+}
+
+func extractMetaRefresh(doc *goquery.Document) (links []*Link) {
+	doc.FindMatcher(metaRefreshMatcher).Each(func(_ int, s *goquery.Selection) {
+		if equiv, _ := s.Attr("http-equiv"); !strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+			return
+		}
+		// The content is "<delay>; url=<url>", the url part is optional
+		content, _ := s.Attr("content")
+		i := strings.IndexAny(content, ";,")
+		if i < 0 {
+			return
+		}
+		val := strings.TrimSpace(content[i+1:])
+		if len(val) >= 4 && strings.EqualFold(val[:3], "url") {
+			if rest := strings.TrimSpace(val[3:]); strings.HasPrefix(rest, "=") {
+				val = strings.TrimSpace(rest[1:])
+			}
+		}
+		val = strings.Trim(val, `'"`)
+		if val != "" {
+			links = append(links, &Link{Value: val, Tag: "meta", Attr: "content"})
+		}
+	})
+	return links
+}
+
+func extractFormAction(doc *goquery.Document) (links []*Link) {
+	doc.FindMatcher(formActionMatcher).Each(func(_ int, s *goquery.Selection) {
+		if method, _ := s.Attr("method"); method != "" && !strings.EqualFold(method, "get") {
+			return
+		}
+		val, _ := s.Attr("action")
+		links = append(links, &Link{Value: val, Tag: "form", Attr: "action"})
+	})
+	return links
+}
@@ -0,0 +1,132 @@
+package gocrawl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const testLinksDoc = `<html><head>
+<base href="/dir/">
+<link rel="next" href="next.html">
+<link rel="stylesheet" href="style.css">
+<meta http-equiv="Refresh" content="5; URL='refresh.html'">
+</head><body>
+<a href="a.html" rel="nofollow">a</a>
+<map><area href="area.html"></map>
+<iframe src="iframe.html"></iframe>
+<img srcset="small.jpg 1x, large.jpg 2x">
+<form action="search"></form>
+<form action="post" method="POST"></form>
+</body></html>`
+
+func TestProcessLinks(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(testLinksDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Url, _ = url.Parse("http://host/page.html")
+
+	les, err := lookupLinkExtractors([]string{"a", "area", "link", "iframe", "frame", "srcset", "meta-refresh", "form"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &worker{linkExtractors: les, opts: &Options{}, logFunc: func(LogFlags, string, ...interface{}) {}}
+
+	var got []string
+	for _, l := range w.processLinks(&URLContext{}, doc) {
+		got = append(got, l.Tag+"["+l.Attr+"] "+l.URL.String())
+		if l.Tag == "a" && l.Rel != "nofollow" {
+			t.Errorf("expected the nofollow rel, got %q", l.Rel)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		"a[href] http://host/dir/a.html",
+		"area[href] http://host/dir/area.html",
+		"form[action] http://host/dir/search",
+		"iframe[src] http://host/dir/iframe.html",
+		"img[srcset] http://host/dir/large.jpg",
+		"img[srcset] http://host/dir/small.jpg",
+		"link[href] http://host/dir/next.html",
+		"meta[content] http://host/dir/refresh.html",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("want links:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestRegisterLinkExtractor(t *testing.T) {
+	RegisterLinkExtractor("test-data-href", LinkExtractorFunc(func(doc *goquery.Document) (links []*Link) {
+		doc.Find("[data-href]").Each(func(_ int, s *goquery.Selection) {
+			val, _ := s.Attr("data-href")
+			links = append(links, &Link{Value: val, Tag: goquery.NodeName(s), Attr: "data-href"})
+		})
+		return links
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic on duplicate registration")
+			}
+		}()
+		RegisterLinkExtractor("a", LinkExtractorFunc(nil))
+	}()
+
+	if _, err := lookupLinkExtractors([]string{"a", "nope"}); err == nil {
+		t.Error("expected an error for an unknown extractor")
+	}
+
+	var mu sync.Mutex
+	links := make(map[string]*Link)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<html><body><a href="/a">a</a><div data-href="/b"></div></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	spy.setExtensionMethod(eMKFilter, func(ctx *URLContext, isVisited bool) bool {
+		mu.Lock()
+		links[ctx.URL().Path] = ctx.Link()
+		mu.Unlock()
+		return !isVisited
+	})
+	var harvested interface{}
+	spy.setExtensionMethod(eMKVisited, func(ctx *URLContext, h interface{}) {
+		if ctx.URL().Path == "/" {
+			harvested = h
+		}
+	})
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LinkExtractors = []string{"test-data-href"}
+	c := NewCrawlerWithOptions(opts)
+	if err := c.Run(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(links) != 2 || links["/"] != nil {
+		t.Fatalf("expected the seed and /b, got %v", links)
+	}
+	if l := links["/b"]; l == nil || l.Tag != "div" || l.Attr != "data-href" || l.URL.String() != srv.URL+"/b" {
+		t.Errorf("unexpected link for /b: %+v", l)
+	}
+	// Visited still receives the URLs
+	if urls, ok := harvested.([]*url.URL); !ok || len(urls) != 1 || urls[0].String() != srv.URL+"/b" {
+		t.Errorf("expected the harvested URLs to be [%s/b], got %#v", srv.URL, harvested)
+	}
+
+	opts.LinkExtractors = []string{"nope"}
+	if err := c.Run(srv.URL + "/"); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("expected an unknown extractor error, got %v", err)
+	}
+}
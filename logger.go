@@ -1,7 +1,11 @@
 package gocrawl
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
 )
 
 // LogFlags is a set of flags that control the logging of the Crawler.
@@ -18,12 +22,93 @@ const (
 	LogAll  LogFlags = LogError | LogInfo | LogEnqueued | LogIgnored | LogTrace
 )
 
-func getLogFunc(ext Extender, verbosity LogFlags, workerIndex int) func(LogFlags, string, ...interface{}) {
+// String returns the name of the log category of a single flag, as set in
+// the "category" attribute of the structured log events (see
+// Options.Logger).
+func (lf LogFlags) String() string {
+	switch lf {
+	case LogError:
+		return "error"
+	case LogInfo:
+		return "info"
+	case LogEnqueued:
+		return "enqueued"
+	case LogIgnored:
+		return "ignored"
+	case LogTrace:
+		return "trace"
+	case LogNone:
+		return "none"
+	case LogAll:
+		return "all"
+	}
+	return fmt.Sprintf("LogFlags(%d)", uint(lf))
+}
+
+// The slog level of each log category.
+func (lf LogFlags) level() slog.Level {
+	switch lf {
+	case LogError:
+		return slog.LevelError
+	case LogInfo:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+// Get the log function of the crawler (workerIndex is -1) or of a worker.
+// The values that are slog.Attr are not used to format the message, they
+// are the attributes of the event if a structured logger is set, in which
+// case the events are sent to the logger instead of Extender.Log.
+func getLogFunc(ext Extender, logger *slog.Logger, verbosity LogFlags, workerIndex int, host string) func(LogFlags, string, ...interface{}) {
+	if logger != nil && workerIndex > 0 {
+		logger = logger.With(slog.Int("worker", workerIndex), slog.String("host", host))
+	}
+
 	return func(minLevel LogFlags, format string, vals ...interface{}) {
-		if workerIndex > 0 {
-			ext.Log(verbosity, minLevel, fmt.Sprintf(fmt.Sprintf("worker %d - %s", workerIndex, format), vals...))
+		var attrs []slog.Attr
+
+		args := vals[:0:0]
+		for _, v := range vals {
+			if a, ok := v.(slog.Attr); ok {
+				attrs = append(attrs, a)
+			} else {
+				args = append(args, v)
+			}
+		}
+
+		if logger != nil {
+			ctx := context.Background()
+			if verbosity&minLevel != minLevel || !logger.Enabled(ctx, minLevel.level()) {
+				return
+			}
+			attrs = append(attrs, slog.String("category", minLevel.String()))
+			logger.LogAttrs(ctx, minLevel.level(), fmt.Sprintf(format, args...), attrs...)
+		} else if workerIndex > 0 {
+			ext.Log(verbosity, minLevel, fmt.Sprintf(fmt.Sprintf("worker %d - %s", workerIndex, format), args...))
 		} else {
-			ext.Log(verbosity, minLevel, fmt.Sprintf(format, vals...))
+			ext.Log(verbosity, minLevel, fmt.Sprintf(format, args...))
 		}
 	}
 }
+
+// Helpers for the common attributes of the log events.
+
+func urlAttr(u *url.URL) slog.Attr {
+	if u == nil {
+		return slog.String("url", "")
+	}
+	return slog.String("url", u.String())
+}
+
+func statusAttr(code int) slog.Attr {
+	return slog.Int("status", code)
+}
+
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Duration("duration", d)
+}
+
+func errAttr(err error) slog.Attr {
+	return slog.Any("error", err)
+}
@@ -0,0 +1,100 @@
+package gocrawl
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogFuncAttrs(t *testing.T) {
+	spy := newSpy(new(DefaultExtender), true)
+	lf := getLogFunc(spy, nil, LogAll, 2, "host")
+	lf(LogError, "ERROR status code for %s: %s", "http://host/a", "404 Not Found", statusAttr(404), slog.String("url", "http://host/a"))
+	assertIsInLog("LogFuncAttrs", spy.b, "worker 2 - ERROR status code for http://host/a: 404 Not Found\n", t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	spy = newSpy(new(DefaultExtender), true)
+	lf = getLogFunc(spy, logger, LogError|LogIgnored, 2, "host")
+	lf(LogError, "ERROR status code for %s: %s", "http://host/a", "404 Not Found", statusAttr(404), slog.String("url", "http://host/a"))
+	lf(LogInfo, "not logged: %s", "http://host/b", slog.String("url", "http://host/b"))
+	if spy.b.Len() != 0 {
+		t.Errorf("expected no call to Extender.Log, got %s", spy.b.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 event, got %d: %s", len(lines), buf.String())
+	}
+	var ev map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level":    "ERROR",
+		"msg":      "ERROR status code for http://host/a: 404 Not Found",
+		"category": "error",
+		"worker":   float64(2),
+		"host":     "host",
+		"url":      "http://host/a",
+		"status":   float64(404),
+	}
+	for k, v := range want {
+		if ev[k] != v {
+			t.Errorf("%s: want %v, got %v", k, v, ev[k])
+		}
+	}
+}
+
+func TestStructuredLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/":
+			w.Write([]byte(`<html><body><a href="/missing">a</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	opts.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := NewCrawlerWithOptions(opts)
+	c.Run(srv.URL + "/")
+
+	var fetched, errStatus bool
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(l), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev["category"] == nil {
+			t.Errorf("expected a category: %s", l)
+		}
+		switch {
+		case strings.HasPrefix(ev["msg"].(string), "fetched "+srv.URL+"/: 200"):
+			fetched = ev["status"] == float64(200) && ev["url"] == srv.URL+"/" && ev["duration"] != nil && ev["worker"] == float64(1)
+		case strings.HasPrefix(ev["msg"].(string), "ERROR status code"):
+			errStatus = ev["status"] == float64(404) && ev["url"] == srv.URL+"/missing" && ev["category"] == "error"
+		}
+	}
+	if !fetched {
+		t.Errorf("expected a fetched event with attributes")
+	}
+	if !errStatus {
+		t.Errorf("expected a status code error event with attributes")
+	}
+	if spy.b.Len() != 0 {
+		t.Errorf("expected no call to Extender.Log, got %s", spy.b.String())
+	}
+}
@@ -0,0 +1,255 @@
+// Package metrics exposes the metrics of a gocrawl crawl in the Prometheus
+// text exposition format, via an http.Handler.
+//
+// The Metrics collect the fetch durations, the status codes, the errors by
+// kind and the robots.txt disallows through an Extender that wraps the
+// crawler's Extender, and read the queue depths and the worker count from
+// the Crawler's Stats when they are served. It doesn't depend on the
+// Prometheus client library.
+//
+//	m := metrics.New()
+//	opts := gocrawl.NewOptions(m.Wrap(ext))
+//	c := gocrawl.NewCrawlerWithOptions(opts)
+//	m.Crawler = c
+//	http.Handle("/metrics", m)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/gocrawl"
+)
+
+// DefaultBuckets are the default upper bounds, in seconds, of the buckets of
+// the fetch duration histogram.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics collects the metrics of a crawl, and serves them in the
+// Prometheus text exposition format. It is safe for concurrent use.
+type Metrics struct {
+	// Crawler, if set, is the crawler whose Stats are served as gauges
+	// (queue depth by host, active workers) and counters (enqueued,
+	// visited, ignored, bytes fetched).
+	Crawler *gocrawl.Crawler
+
+	// Buckets are the upper bounds of the buckets of the fetch duration
+	// histogram, in increasing order. They must be set before the crawl
+	// starts. New sets them to DefaultBuckets.
+	Buckets []float64
+
+	mu          sync.Mutex
+	durCounts   []uint64
+	durSum      float64
+	durCount    uint64
+	statusCodes map[int]uint64
+	errors      map[gocrawl.CrawlErrorKind]uint64
+	disallowed  uint64
+}
+
+// New returns Metrics with the default buckets.
+func New() *Metrics {
+	return &Metrics{Buckets: DefaultBuckets}
+}
+
+// Wrap returns an Extender that collects the metrics and delegates to the
+// provided Extender. The optional interfaces implemented by the provided
+// Extender are still used by the crawler.
+func (m *Metrics) Wrap(ext gocrawl.Extender) *Extender {
+	return &Extender{ext, m}
+}
+
+// ObserveFetch records the duration and the status code of a fetch, as in
+// the gocrawl.FetchInfo.
+func (m *Metrics) ObserveFetch(fi *gocrawl.FetchInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.durCounts == nil {
+		m.durCounts = make([]uint64, len(m.Buckets))
+		m.statusCodes = make(map[int]uint64)
+	}
+	secs := fi.Duration.Seconds()
+	for i, b := range m.Buckets {
+		if secs <= b {
+			m.durCounts[i]++
+		}
+	}
+	m.durSum += secs
+	m.durCount++
+	m.statusCodes[fi.StatusCode]++
+}
+
+// ObserveError records a crawl error.
+func (m *Metrics) ObserveError(err *gocrawl.CrawlError) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.errors == nil {
+		m.errors = make(map[gocrawl.CrawlErrorKind]uint64)
+	}
+	m.errors[err.Kind]++
+}
+
+// ObserveDisallowed records an URL disallowed by the robots.txt.
+func (m *Metrics) ObserveDisallowed() {
+	m.mu.Lock()
+	m.disallowed++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+
+	m.mu.Lock()
+	header(&b, "gocrawl_fetch_duration_seconds", "histogram", "Duration of the fetches.")
+	for i, bound := range m.Buckets {
+		var n uint64
+		if i < len(m.durCounts) {
+			n = m.durCounts[i]
+		}
+		fmt.Fprintf(&b, "gocrawl_fetch_duration_seconds_bucket{le=%q} %d\n", formatFloat(bound), n)
+	}
+	fmt.Fprintf(&b, "gocrawl_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durCount)
+	fmt.Fprintf(&b, "gocrawl_fetch_duration_seconds_sum %s\n", formatFloat(m.durSum))
+	fmt.Fprintf(&b, "gocrawl_fetch_duration_seconds_count %d\n", m.durCount)
+
+	header(&b, "gocrawl_responses_total", "counter", "Number of responses by status code.")
+	codes := make([]int, 0, len(m.statusCodes))
+	for code := range m.statusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, "gocrawl_responses_total{code=\"%d\"} %d\n", code, m.statusCodes[code])
+	}
+
+	header(&b, "gocrawl_errors_total", "counter", "Number of errors by kind.")
+	kinds := make([]string, 0, len(m.errors))
+	errs := make(map[string]uint64, len(m.errors))
+	for k, n := range m.errors {
+		kinds = append(kinds, k.String())
+		errs[k.String()] = n
+	}
+	sort.Strings(kinds)
+	for _, k := range kinds {
+		fmt.Fprintf(&b, "gocrawl_errors_total{kind=\"%s\"} %d\n", escape(k), errs[k])
+	}
+
+	header(&b, "gocrawl_robots_disallowed_total", "counter", "Number of URLs disallowed by the robots.txt.")
+	fmt.Fprintf(&b, "gocrawl_robots_disallowed_total %d\n", m.disallowed)
+	m.mu.Unlock()
+
+	if m.Crawler != nil {
+		writeStats(&b, m.Crawler.Stats())
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Write the metrics from the crawler's Stats.
+func writeStats(b *strings.Builder, s *gocrawl.Stats) {
+	header(b, "gocrawl_enqueued_total", "counter", "Number of URLs enqueued.")
+	fmt.Fprintf(b, "gocrawl_enqueued_total %d\n", s.Enqueued)
+	header(b, "gocrawl_visited_total", "counter", "Number of URLs visited.")
+	fmt.Fprintf(b, "gocrawl_visited_total %d\n", s.Visited)
+
+	header(b, "gocrawl_ignored_total", "counter", "Number of URLs ignored by reason.")
+	reasons := make([]string, 0, len(s.Ignored))
+	for r := range s.Ignored {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(b, "gocrawl_ignored_total{reason=\"%s\"} %d\n", escape(r), s.Ignored[r])
+	}
+
+	header(b, "gocrawl_fetched_bytes_total", "counter", "Number of bytes of the response bodies read.")
+	fmt.Fprintf(b, "gocrawl_fetched_bytes_total %d\n", s.BytesFetched)
+	header(b, "gocrawl_workers", "gauge", "Number of active workers.")
+	fmt.Fprintf(b, "gocrawl_workers %d\n", s.ActiveWorkers)
+
+	hosts := make([]string, 0, len(s.Hosts))
+	for h := range s.Hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	header(b, "gocrawl_queue_depth", "gauge", "Number of URLs waiting to be processed by host.")
+	for _, h := range hosts {
+		fmt.Fprintf(b, "gocrawl_queue_depth{host=\"%s\"} %d\n", escape(h), s.Hosts[h].Queued)
+	}
+	header(b, "gocrawl_crawl_delay_seconds", "gauge", "Last crawl delay by host.")
+	for _, h := range hosts {
+		fmt.Fprintf(b, "gocrawl_crawl_delay_seconds{host=\"%s\"} %s\n", escape(h), formatFloat(s.Hosts[h].CrawlDelay.Seconds()))
+	}
+}
+
+func header(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Escape a label value.
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// Extender is a gocrawl.Extender that collects the metrics, and delegates
+// to the wrapped Extender. See Metrics.Wrap.
+type Extender struct {
+	gocrawl.Extender
+	m *Metrics
+}
+
+// Unwrap returns the wrapped Extender, it implements
+// gocrawl.ExtenderWrapper.
+func (e *Extender) Unwrap() gocrawl.Extender {
+	return e.Extender
+}
+
+// Fetch records the duration and the status code of the fetch made by the
+// wrapped Extender. The duration is measured like FetchInfo.Duration.
+func (e *Extender) Fetch(ctx *gocrawl.URLContext, userAgent string, headRequest bool) (*http.Response, error) {
+	start := time.Now()
+	res, err := e.Extender.Fetch(ctx, userAgent, headRequest)
+	if err == nil {
+		e.m.ObserveFetch(&gocrawl.FetchInfo{
+			Ctx:           ctx,
+			Duration:      time.Since(start),
+			StatusCode:    res.StatusCode,
+			IsHeadRequest: headRequest,
+		})
+	}
+	return res, err
+}
+
+// Error records the error and calls the wrapped Extender.
+func (e *Extender) Error(err *gocrawl.CrawlError) {
+	e.m.ObserveError(err)
+	e.Extender.Error(err)
+}
+
+// Disallowed records the disallowed URL and calls the wrapped Extender.
+func (e *Extender) Disallowed(ctx *gocrawl.URLContext) {
+	e.m.ObserveDisallowed()
+	e.Extender.Disallowed(ctx)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/gocrawl"
+)
+
+func TestObserve(t *testing.T) {
+	m := New()
+	m.Buckets = []float64{0.1, 1}
+	m.ObserveFetch(&gocrawl.FetchInfo{Duration: 50 * time.Millisecond, StatusCode: 200})
+	m.ObserveFetch(&gocrawl.FetchInfo{Duration: 500 * time.Millisecond, StatusCode: 200})
+	m.ObserveFetch(&gocrawl.FetchInfo{Duration: 2 * time.Second, StatusCode: 404})
+	m.ObserveError(&gocrawl.CrawlError{Kind: gocrawl.CekHttpStatusCode})
+	m.ObserveDisallowed()
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP gocrawl_fetch_duration_seconds Duration of the fetches.
+# TYPE gocrawl_fetch_duration_seconds histogram
+gocrawl_fetch_duration_seconds_bucket{le="0.1"} 1
+gocrawl_fetch_duration_seconds_bucket{le="1"} 2
+gocrawl_fetch_duration_seconds_bucket{le="+Inf"} 3
+gocrawl_fetch_duration_seconds_sum 2.55
+gocrawl_fetch_duration_seconds_count 3
+# HELP gocrawl_responses_total Number of responses by status code.
+# TYPE gocrawl_responses_total counter
+gocrawl_responses_total{code="200"} 2
+gocrawl_responses_total{code="404"} 1
+# HELP gocrawl_errors_total Number of errors by kind.
+# TYPE gocrawl_errors_total counter
+gocrawl_errors_total{kind="HttpStatusCode"} 1
+# HELP gocrawl_robots_disallowed_total Number of URLs disallowed by the robots.txt.
+# TYPE gocrawl_robots_disallowed_total counter
+gocrawl_robots_disallowed_total 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := escape("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("unexpected escaped value %s", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/private">p</a> <a href="/missing">m</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	de := new(gocrawl.DefaultExtender)
+	m := New()
+	opts := gocrawl.NewOptions(m.Wrap(de))
+	opts.CrawlDelay = 0
+	opts.LogFlags = gocrawl.LogNone
+	c := gocrawl.NewCrawlerWithOptions(opts)
+	m.Crawler = c
+	if err := c.Run(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	if de.Enqueuer == nil {
+		t.Error("expected the Enqueuer to be set on the wrapped Extender")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+	body := rec.Body.String()
+	for _, s := range []string{
+		"gocrawl_fetch_duration_seconds_count 3\n",
+		`gocrawl_responses_total{code="200"} 2` + "\n",
+		`gocrawl_responses_total{code="404"} 1` + "\n",
+		`gocrawl_errors_total{kind="HttpStatusCode"} 1` + "\n",
+		"gocrawl_robots_disallowed_total 1\n",
+		"gocrawl_enqueued_total 3\n",
+		"gocrawl_visited_total 1\n",
+		`gocrawl_ignored_total{reason="robots"} 1` + "\n",
+		"gocrawl_workers 0\n",
+		`gocrawl_queue_depth{host="` + u.Host + `"} 0` + "\n",
+		`gocrawl_crawl_delay_seconds{host="` + u.Host + `"} 0` + "\n",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in:\n%s", s, body)
+		}
+	}
+}
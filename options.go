@@ -1,6 +1,7 @@
 package gocrawl
 
 import (
+	"log/slog"
 	"time"
 
 	"github.com/PuerkitoBio/purell"
@@ -14,6 +15,8 @@ const (
 	DefaultHostBufferFactor   int                       = 10
 	DefaultCrawlDelay         time.Duration             = 5 * time.Second
 	DefaultIdleTTL            time.Duration             = 10 * time.Second
+	DefaultRobotsRetryDelay   time.Duration             = time.Minute
+	DefaultRobotsMaxAttempts  int                       = 5
 	DefaultNormalizationFlags purell.NormalizationFlags = purell.FlagsAllGreedy
 )
 
@@ -34,7 +37,13 @@ type Options struct {
 	// automatically stopping the crawler.
 	MaxVisits int
 
-	// EnqueueChanBuffer is the size of the buffer for the enqueue channel.
+	// MaxDepth is the maximum link depth (see URLContext.Depth) of the
+	// URLs to enqueue. Seeds have a depth of 0. If zero, there is no
+	// maximum depth.
+	MaxDepth int
+
+	// EnqueueChanBuffer is the size of the buffer for the URLs enqueued
+	// via Crawler.Enqueue.
 	EnqueueChanBuffer int
 
 	// HostBufferFactor controls the size of the map and channel used
@@ -56,16 +65,107 @@ type Options struct {
 	// when the worker is available, but there are no URLs to process.
 	WorkerIdleTTL time.Duration
 
+	// RobotsRetryDelay is the delay before fetching an unreachable
+	// robots.txt again (a server error, a 429 status code or a network
+	// error). The URLs of the host wait in its worker meanwhile.
+	RobotsRetryDelay time.Duration
+
+	// RobotsMaxAttempts is the maximum number of attempts to fetch an
+	// unreachable robots.txt. Once reached, the URLs of the host are
+	// disallowed until the robots.txt is fetched again, 24 hours later.
+	// If zero, the URLs are disallowed after the first attempt.
+	RobotsMaxAttempts int
+
+	// MaxConcurrentHosts is the maximum number of workers (hosts) that
+	// can fetch at the same time, the other workers wait their turn. If
+	// zero, there is no limit.
+	MaxConcurrentHosts int
+
+	// MaxRequestsPerSecond is the maximum number of requests per second
+	// made by all workers combined, in addition to the per-host crawl
+	// delay. If zero, there is no limit.
+	MaxRequestsPerSecond float64
+
 	// SameHostOnly limits the URLs to enqueue only to those targeting
 	// the same hosts as the ones from the seed URLs.
 	SameHostOnly bool
 
+	// Scope defines which hosts are in the scope of the crawl, the URLs
+	// of other hosts are not enqueued. The default, ScopeDefault, uses
+	// SameHostOnly.
+	Scope ScopeMode
+
+	// AllowedHosts is the list of hosts in scope for ScopeHostList, as
+	// host names optionally followed by a port (the default ports 80 and
+	// 443 are ignored).
+	AllowedHosts []string
+
+	// IncludeRules and ExcludeRules are declarative rules checked
+	// before the Extender's Filter method: a URL that matches one of
+	// the ExcludeRules is ignored, and if IncludeRules is set, a URL
+	// must match one of them. The rule that ignored a URL is logged
+	// under LogIgnored.
+	IncludeRules []*URLRule
+	ExcludeRules []*URLRule
+
+	// SeedPathPrefix limits the URLs of the hosts of the seed URLs to
+	// those under the directory of the path of a seed URL of the same
+	// host, e.g. a seed of http://host/docs/index.html limits the URLs
+	// of this host to http://host/docs/.
+	SeedPathPrefix bool
+
+	// MaxURLLength is the maximum length of the normalized URLs to
+	// enqueue. If zero, there is no limit.
+	MaxURLLength int
+
+	// MaxQueryParams is the maximum number of query parameters of the
+	// URLs to enqueue. If zero, there is no limit.
+	MaxQueryParams int
+
 	// HeadBeforeGet asks the crawler to make a HEAD request before
 	// making an eventual GET request. If set to true, the extender
 	// method RequestGet is called after the HEAD to control if the
 	// GET should be issued.
 	HeadBeforeGet bool
 
+	// HonorRobotsDirectives asks the crawler to honour the nofollow
+	// directives when harvesting the links of a page: the robots meta
+	// tags and X-Robots-Tag headers (generic, or specific to the
+	// RobotUserAgent), and the links with a rel="nofollow" attribute.
+	// The directives are available via URLContext.RobotsDirectives
+	// whether this is set or not.
+	HonorRobotsDirectives bool
+
+	// CanonicalIdentity uses the canonical URL declared by a visited page
+	// (see URLContext.CanonicalURL) as its identity: the canonical URL is
+	// marked as visited, so that it is not visited again when it is
+	// discovered directly.
+	CanonicalIdentity bool
+
+	// LinkExtractors is the list of the names of the link extractors used
+	// to harvest the links of the visited pages, when the Extender's Visit
+	// method asks the crawler to process the links. See
+	// RegisterLinkExtractor for the built-in extractors. If nil, the "a"
+	// extractor is used.
+	LinkExtractors []string
+
+	// FetchSitemaps asks the crawler to fetch the sitemaps listed in the
+	// robots.txt of each host, and to enqueue the URLs they contain.
+	// Sitemap indexes and gzip-compressed sitemaps are supported. The
+	// SitemapRequester interface can be implemented by the Extender to
+	// control which sitemaps are fetched.
+	FetchSitemaps bool
+
+	// ResponseSink receives the raw responses fetched by the crawler,
+	// for example to archive them (see the warc subpackage). If nil,
+	// responses are not recorded.
+	ResponseSink ResponseSink
+
+	// RetryPolicy controls the retry of transient fetch failures. If
+	// nil, failed fetches are not retried. It can be overridden by
+	// implementing the Retrier interface on the Extender.
+	RetryPolicy *RetryPolicy
+
 	// URLNormalizationFlags controls the normalization of URLs.
 	// See the purell package for details.
 	URLNormalizationFlags purell.NormalizationFlags
@@ -73,6 +173,39 @@ type Options struct {
 	// LogFlags controls the verbosity of the logger.
 	LogFlags LogFlags
 
+	// Logger, if set, receives the log events as structured records
+	// instead of the Extender's Log method. The events have a "category"
+	// attribute (the name of the LogFlags), the events of the workers
+	// have "worker" and "host" attributes, and depending on the event,
+	// "url", "status", "duration" and "error" attributes. The message is
+	// the same as the one sent to Extender.Log, without the worker
+	// prefix. The LogFlags still control which events are logged.
+	Logger *slog.Logger
+
+	// DuplicateDetector, if set, detects the visited documents whose
+	// content is an exact or near duplicate of an already visited
+	// document. Duplicates are not visited and their links are not
+	// harvested, unless the DuplicateVisitor interface implemented by the
+	// Extender asks for it.
+	DuplicateDetector *DuplicateDetector
+
+	// RevisitPolicy enables the long-running mode: the visited URLs are
+	// visited again after the interval computed by the policy (see
+	// FixedRevisitPolicy and AdaptiveRevisitPolicy), and the crawler keeps
+	// running as long as URLs are scheduled, until it is stopped or
+	// MaxVisits is reached. If nil, each URL is visited once.
+	RevisitPolicy RevisitPolicy
+
+	// Store persists the crawl frontier and visited set. If set, the
+	// crawl resumes from the saved state when Run is called, and the
+	// state is saved when the crawl ends.
+	Store Store
+
+	// CheckpointInterval is the interval at which the crawl state is
+	// saved to the Store while the crawl runs. If zero, the state is
+	// only saved when the crawl ends.
+	CheckpointInterval time.Duration
+
 	// Extender is the implementation of hooks to use by the crawler.
 	Extender Extender
 }
@@ -84,17 +217,17 @@ type Options struct {
 func NewOptions(ext Extender) *Options {
 	// Use defaults except for Extender
 	return &Options{
-		DefaultUserAgent,
-		DefaultRobotUserAgent,
-		0,
-		DefaultEnqueueChanBuffer,
-		DefaultHostBufferFactor,
-		DefaultCrawlDelay,
-		DefaultIdleTTL,
-		true,
-		false,
-		DefaultNormalizationFlags,
-		LogError,
-		ext,
+		UserAgent:             DefaultUserAgent,
+		RobotUserAgent:        DefaultRobotUserAgent,
+		EnqueueChanBuffer:     DefaultEnqueueChanBuffer,
+		HostBufferFactor:      DefaultHostBufferFactor,
+		CrawlDelay:            DefaultCrawlDelay,
+		WorkerIdleTTL:         DefaultIdleTTL,
+		RobotsRetryDelay:      DefaultRobotsRetryDelay,
+		RobotsMaxAttempts:     DefaultRobotsMaxAttempts,
+		SameHostOnly:          true,
+		URLNormalizationFlags: DefaultNormalizationFlags,
+		LogFlags:              LogError,
+		Extender:              ext,
 	}
 }
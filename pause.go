@@ -0,0 +1,158 @@
+package gocrawl
+
+import (
+	"sync"
+)
+
+// A pause gate, shared by the crawler and the workers. While paused, the
+// channel returned by wait is closed on resume.
+type pauseGate struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func (p *pauseGate) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ch != nil {
+		return false
+	}
+	p.ch = make(chan struct{})
+	return true
+}
+
+func (p *pauseGate) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ch == nil {
+		return false
+	}
+	close(p.ch)
+	p.ch = nil
+	return true
+}
+
+// Return the channel closed on resume, or nil if not paused.
+func (p *pauseGate) wait() <-chan struct{} {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ch
+}
+
+// Pause suspends the fetching of all hosts until Resume is called. The
+// URLs being fetched are processed, but the workers don't fetch other URLs
+// while paused. The URLs can still be enqueued, and the workers' queues,
+// robots.txt and the visited URLs are kept, so that the crawl resumes where
+// it left off. The workers are not cleared on idle policy while paused. It
+// has no effect if the crawler is not running.
+func (c *Crawler) Pause() {
+	if p := c.crawlPauseGate(); p != nil && p.pause() {
+		c.logFunc(LogInfo, "crawler paused")
+	}
+}
+
+// Resume resumes the fetching of the hosts after a call to Pause. The hosts
+// paused with PauseHost remain paused.
+func (c *Crawler) Resume() {
+	if p := c.crawlPauseGate(); p != nil && p.resume() {
+		c.logFunc(LogInfo, "crawler resumed")
+	}
+}
+
+// PauseHost suspends the fetching of the host until ResumeHost is called,
+// like Pause does for all hosts. The host is the host of the normalized
+// URLs (e.g. "example.com" or "example.com:8080"), it can be paused before
+// its first URL is enqueued. It has no effect if the crawler is not
+// running.
+func (c *Crawler) PauseHost(host string) {
+	if p := c.hostPauseGate(host); p != nil && p.pause() {
+		c.logFunc(LogInfo, "host %s paused", host)
+	}
+}
+
+// ResumeHost resumes the fetching of the host after a call to PauseHost.
+// The host remains paused if Pause was called.
+func (c *Crawler) ResumeHost(host string) {
+	if p := c.hostPauseGate(host); p != nil && p.resume() {
+		c.logFunc(LogInfo, "host %s resumed", host)
+	}
+}
+
+// Get the pause gate of the crawl. It returns nil if the crawler is not
+// running.
+func (c *Crawler) crawlPauseGate() *pauseGate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isRunning() {
+		return nil
+	}
+	return c.pause
+}
+
+// Get the pause gate of the host, creating it if required. It returns nil
+// if the crawler is not running.
+func (c *Crawler) hostPauseGate(host string) *pauseGate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.isRunning() {
+		return nil
+	}
+	p, ok := c.hostPauses[host]
+	if !ok {
+		p = new(pauseGate)
+		c.hostPauses[host] = p
+	}
+	return p
+}
+
+// Indicates if the crawler is running, that is Run was called and did not
+// return yet. The caller must hold c.mu.
+func (c *Crawler) isRunning() bool {
+	if c.done == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Wait while the crawler or the host is paused, or until the crawler shuts
+// down. Returns false if the worker must terminate.
+func (w *worker) waitWhilePaused() bool {
+	for {
+		all, host := w.pause.wait(), w.hostPause.wait()
+		if all == nil && host == nil {
+			return true
+		}
+		w.logFunc(LogInfo, "paused, waiting for resume...")
+		select {
+		case <-all:
+		case <-host:
+		case <-w.drain:
+			return true
+		case <-w.stop:
+			w.logFunc(LogInfo, "stop signal received.")
+			return false
+		}
+	}
+}
+
+// Indicates if the crawler or the host is paused, and return a channel
+// closed when it may be resumed.
+func (w *worker) paused() (bool, <-chan struct{}) {
+	if ch := w.pause.wait(); ch != nil {
+		return true, ch
+	}
+	if ch := w.hostPause.wait(); ch != nil {
+		return true, ch
+	}
+	return false, nil
+}
@@ -0,0 +1,191 @@
+package gocrawl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestPauseIdleTTL(t *testing.T) {
+	push := make(chan *workerResponse, 1)
+	w := &worker{
+		host:      "host",
+		push:      push,
+		pop:       newPopChannel(),
+		stop:      make(chan struct{}),
+		pause:     new(pauseGate),
+		hostPause: new(pauseGate),
+		opts:      &Options{WorkerIdleTTL: 10 * time.Millisecond},
+		logFunc:   func(LogFlags, string, ...interface{}) {},
+	}
+
+	for _, p := range []*pauseGate{w.pause, w.hostPause} {
+		p.pause()
+		done := make(chan bool)
+		go func() { done <- w.waitForURLs() }()
+		select {
+		case <-done:
+			t.Fatal("expected no idle timeout while paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+		p.resume()
+		if !<-done {
+			t.Fatal("expected the worker to continue on resume")
+		}
+	}
+
+	// Not paused, times out
+	if w.waitForURLs() {
+		t.Fatal("expected an idle timeout")
+	}
+	if res := <-push; !res.idleDeath {
+		t.Error("expected an idle death response")
+	}
+}
+
+func TestWaitWhilePaused(t *testing.T) {
+	stop := make(chan struct{})
+	w := &worker{stop: stop, pause: new(pauseGate), hostPause: new(pauseGate), logFunc: func(LogFlags, string, ...interface{}) {}}
+	if !w.waitWhilePaused() {
+		t.Fatal("expected not paused")
+	}
+
+	w.pause.pause()
+	w.hostPause.pause()
+	done := make(chan bool)
+	go func() { done <- w.waitWhilePaused() }()
+	w.pause.resume()
+	select {
+	case <-done:
+		t.Fatal("expected to wait while the host is paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	w.hostPause.resume()
+	if !<-done {
+		t.Fatal("expected to continue on resume")
+	}
+
+	w.pause.pause()
+	go func() { done <- w.waitWhilePaused() }()
+	close(stop)
+	if <-done {
+		t.Fatal("expected to stop")
+	}
+}
+
+type pauseExtender struct {
+	*spyExtender
+	c    *Crawler
+	host bool
+}
+
+func (x *pauseExtender) Visit(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+	if ctx.URL().Path == "/" {
+		if x.host {
+			x.c.PauseHost(ctx.NormalizedURL().Host)
+		} else {
+			x.c.Pause()
+		}
+	}
+	return x.spyExtender.Visit(ctx, res, doc)
+}
+
+func TestPauseNotRunning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>page</body></html>`))
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	// Before Run, the calls are ignored
+	c.Pause()
+	c.PauseHost("example.com")
+	if err := c.Run(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	assertCallCount(spy, "PauseNotRunning", eMKVisit, 1, t)
+
+	// After Run, the calls do not create pause gates
+	c.Pause()
+	c.PauseHost("example.com")
+	if c.pause.wait() != nil {
+		t.Error("expected the crawl not to be paused")
+	}
+	if _, ok := c.hostPauses["example.com"]; ok {
+		t.Error("expected no pause gate for the host")
+	}
+	assertIsNotInLog("PauseNotRunning", spy.b, "paused", t)
+}
+
+func TestPauseResume(t *testing.T) {
+	var fetched int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+			return
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/b">b</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body>page</body></html>`))
+		}
+		atomic.AddInt32(&fetched, 1)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	for _, host := range []bool{false, true} {
+		atomic.StoreInt32(&fetched, 0)
+		x := &pauseExtender{spyExtender: newSpy(new(DefaultExtender), true), host: host}
+		opts := NewOptions(x)
+		opts.CrawlDelay = 0
+		opts.WorkerIdleTTL = 10 * time.Millisecond
+		opts.LogFlags = LogAll
+		c := NewCrawlerWithOptions(opts)
+		x.c = c
+
+		done := make(chan error)
+		go func() { done <- c.Run(srv.URL + "/") }()
+
+		time.Sleep(100 * time.Millisecond)
+		if n := atomic.LoadInt32(&fetched); n != 1 {
+			t.Errorf("host=%v: expected 1 fetch while paused, got %d", host, n)
+		}
+		if hs := c.Stats().Hosts[u.Host]; hs.Queued != 2 {
+			t.Errorf("host=%v: expected 2 queued URLs while paused, got %d", host, hs.Queued)
+		}
+		if host {
+			// Resuming the crawler does not resume the host
+			c.Resume()
+			time.Sleep(20 * time.Millisecond)
+			if n := atomic.LoadInt32(&fetched); n != 1 {
+				t.Errorf("host=%v: expected 1 fetch after Resume, got %d", host, n)
+			}
+			c.ResumeHost(u.Host)
+		} else {
+			c.Resume()
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("host=%v: unexpected error %v", host, err)
+			}
+		case <-time.After(time.Second):
+			c.Stop()
+			t.Fatalf("host=%v: expected the crawl to end after resume", host)
+		}
+		assertCallCount(x.spyExtender, "PauseResume", eMKVisit, 3, t)
+		assertIsInLog("PauseResume", x.b, "paused, waiting for resume...", t)
+	}
+}
@@ -1,7 +1,7 @@
 package gocrawl
 
 // The pop channel is a stacked channel used by workers to pop the next URL(s)
-// to process.
+// to process. The popped URLs are then pushed in the worker's priority queue.
 type popChannel chan []*URLContext
 
 // Constructor to create and initialize a popChannel
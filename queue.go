@@ -0,0 +1,68 @@
+package gocrawl
+
+import (
+	"container/heap"
+)
+
+// The URL queue is the priority queue used by a worker to select the next URL
+// to process. The robots.txt URL always comes first, then URLs with a higher
+// Priority are processed first, and URLs with the same priority are processed
+// in the order they were pushed.
+type urlQueue struct {
+	items []*queueItem
+	seq   uint64
+}
+
+type queueItem struct {
+	ctx *URLContext
+	seq uint64
+}
+
+// Push the URLs in the queue.
+func (q *urlQueue) push(ctxs ...*URLContext) {
+	for _, ctx := range ctxs {
+		q.seq++
+		heap.Push(q, &queueItem{ctx, q.seq})
+	}
+}
+
+// Pop the URL with the highest priority from the queue.
+func (q *urlQueue) pop() *URLContext {
+	return heap.Pop(q).(*queueItem).ctx
+}
+
+// Len implements sort.Interface for heap.Interface.
+func (q *urlQueue) Len() int {
+	return len(q.items)
+}
+
+// Less implements sort.Interface for heap.Interface.
+func (q *urlQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if ra, rb := a.ctx.IsRobotsURL(), b.ctx.IsRobotsURL(); ra != rb {
+		return ra
+	}
+	if a.ctx.Priority != b.ctx.Priority {
+		return a.ctx.Priority > b.ctx.Priority
+	}
+	return a.seq < b.seq
+}
+
+// Swap implements sort.Interface for heap.Interface.
+func (q *urlQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+}
+
+// Push implements heap.Interface, use push instead.
+func (q *urlQueue) Push(x interface{}) {
+	q.items = append(q.items, x.(*queueItem))
+}
+
+// Pop implements heap.Interface, use pop instead.
+func (q *urlQueue) Pop() interface{} {
+	n := len(q.items)
+	it := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	return it
+}
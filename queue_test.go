@@ -0,0 +1,34 @@
+package gocrawl
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestURLQueue(t *testing.T) {
+	newCtx := func(s string, prio int) *URLContext {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatalf("failed to parse URL %s", s)
+		}
+		return &URLContext{Priority: prio, url: u, normalizedURL: u}
+	}
+
+	var q urlQueue
+	q.push(newCtx("http://host/a", 0), newCtx("http://host/b", 5))
+	q.push(newCtx("http://host/robots.txt", 0), newCtx("http://host/c", 0))
+	q.push(newCtx("http://host/d", 5), newCtx("http://host/e", -1))
+
+	want := []string{"/robots.txt", "/b", "/d", "/a", "/c", "/e"}
+	for i, w := range want {
+		if q.Len() == 0 {
+			t.Fatalf("%d: queue is empty, want %s", i, w)
+		}
+		if got := q.pop().url.Path; got != w {
+			t.Errorf("%d: want %s, got %s", i, w, got)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("want empty queue, got %d items", q.Len())
+	}
+}
@@ -0,0 +1,162 @@
+package gocrawl
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default retry policy values, see NewRetryPolicy.
+const (
+	DefaultRetryMaxAttempts    int           = 3
+	DefaultRetryInitialBackoff time.Duration = 1 * time.Second
+	DefaultRetryMaxBackoff     time.Duration = 30 * time.Second
+	DefaultRetryMultiplier     float64       = 2
+	DefaultRetryJitter         float64       = 0.2
+
+	// DefaultThrottleMaxAttempts is the maximum number of fetch attempts
+	// for an URL that gets throttled by the host (429 status code, or 503
+	// with a Retry-After header) when no RetryPolicy is set.
+	DefaultThrottleMaxAttempts int = 3
+)
+
+// RetryPolicy controls how transient fetch failures are retried. A failed
+// URL is re-scheduled on the same worker after a backoff delay (the crawl
+// delay still applies), so the Error extender method is only called once
+// the URL fails for good.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of fetch attempts for an URL,
+	// including the first one.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+
+	// Multiplier is the factor applied to the backoff delay after each
+	// attempt.
+	Multiplier float64
+
+	// Jitter randomizes the backoff delay by up to this fraction of the
+	// delay, in both directions (e.g. 0.2 for +/- 20%).
+	Jitter float64
+
+	// StatusCodes is the list of HTTP status codes that qualify for a retry.
+	StatusCodes []int
+
+	// RetryableError indicates if a Fetch error qualifies for a retry. If
+	// nil, network errors (timeouts, connection errors and unexpected EOFs)
+	// are retried.
+	RetryableError func(error) bool
+}
+
+// NewRetryPolicy returns a RetryPolicy with default values, that retries
+// the 500, 502, 503 and 504 status codes and network errors.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    DefaultRetryMaxAttempts,
+		InitialBackoff: DefaultRetryInitialBackoff,
+		MaxBackoff:     DefaultRetryMaxBackoff,
+		Multiplier:     DefaultRetryMultiplier,
+		Jitter:         DefaultRetryJitter,
+		StatusCodes: []int{
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// Retry returns the backoff delay and true if the fetch that failed
+// with the response's status code or with the error should be attempted
+// again. The attempt is the number of failed attempts so far.
+func (rp *RetryPolicy) Retry(res *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= rp.MaxAttempts || !rp.qualifies(res, err) {
+		return 0, false
+	}
+	return rp.Backoff(attempt), true
+}
+
+// Backoff returns the delay to wait before the next attempt, given the
+// number of failed attempts so far.
+func (rp *RetryPolicy) Backoff(attempt int) time.Duration {
+	mult := rp.Multiplier
+	if mult <= 0 {
+		mult = 1
+	}
+	d := float64(rp.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d += d * rp.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (rp *RetryPolicy) qualifies(res *http.Response, err error) bool {
+	if err != nil {
+		if rp.RetryableError != nil {
+			return rp.RetryableError(err)
+		}
+		return isNetworkError(err)
+	}
+	if res != nil {
+		for _, code := range rp.StatusCodes {
+			if res.StatusCode == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Network errors are considered transient.
+func isNetworkError(err error) bool {
+	var ne net.Error
+	var oe *net.OpError
+
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.As(err, &oe) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Indicates if the status code and headers of a response mean that the host
+// is throttling the crawler.
+func isThrottled(statusCode int, h http.Header) bool {
+	return statusCode == http.StatusTooManyRequests ||
+		(statusCode == http.StatusServiceUnavailable && h.Get("Retry-After") != "")
+}
+
+// Parse the value of a Retry-After header, either a number of seconds or an
+// HTTP date, and return the corresponding delay from now.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
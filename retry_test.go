@@ -0,0 +1,87 @@
+package gocrawl
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	rp := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+	}
+	for _, c := range cases {
+		if got := rp.Backoff(c.attempt); got != c.want {
+			t.Errorf("attempt %d: want %v, got %v", c.attempt, c.want, got)
+		}
+	}
+
+	rp.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := rp.Backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("want backoff between 50ms and 150ms, got %v", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetry(t *testing.T) {
+	rp := NewRetryPolicy()
+	cases := []struct {
+		status  int
+		err     error
+		attempt int
+		want    bool
+	}{
+		{503, nil, 1, true},
+		{503, nil, 3, false},
+		{404, nil, 1, false},
+		{0, io.ErrUnexpectedEOF, 1, true},
+		{0, io.EOF, 1, false},
+		{0, errors.New("not transient"), 1, false},
+	}
+	for i, c := range cases {
+		var res *http.Response
+		if c.err == nil {
+			res = &http.Response{StatusCode: c.status}
+		}
+		if _, got := rp.Retry(res, c.err, c.attempt); got != c.want {
+			t.Errorf("%d: want %t, got %t", i, c.want, got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"Wed, 01 Jan 2020 10:00:30 GMT", 30 * time.Second, true},
+		{"Wed, 01 Jan 2020 09:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.v, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%q: want %v, %t, got %v, %t", c.v, c.want, c.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package gocrawl
+
+import (
+	"bytes"
+	"container/heap"
+	"time"
+)
+
+// Default values of the AdaptiveRevisitPolicy.
+const (
+	DefaultRevisitMinInterval     = time.Hour
+	DefaultRevisitMaxInterval     = 30 * 24 * time.Hour
+	DefaultRevisitInitialInterval = 24 * time.Hour
+	DefaultRevisitFactor          = 2
+)
+
+// VisitInfo contains the information about the past visits of an URL, used
+// by a RevisitPolicy to compute the next visit.
+type VisitInfo struct {
+	// LastVisit is the time of the last visit.
+	LastVisit time.Time
+
+	// Visits is the number of visits, including the last one.
+	Visits int
+
+	// Changes is the number of visits where the content had changed since
+	// the previous visit.
+	Changes int
+
+	// Changed indicates if the content changed on the last visit, based on
+	// the SHA-256 hash of the body. It is true on the first visit, and false
+	// if the last fetch returned 304 Not Modified.
+	Changed bool
+
+	// Interval is the interval returned by the RevisitPolicy for the
+	// previous visit, zero on the first visit.
+	Interval time.Duration
+}
+
+// RevisitPolicy computes when a visited URL should be visited again, in the
+// long-running mode enabled by Options.RevisitPolicy. RevisitAfter returns
+// the interval after which the URL is visited again, or zero if it should
+// not be visited again.
+type RevisitPolicy interface {
+	RevisitAfter(ctx *URLContext, vi *VisitInfo) time.Duration
+}
+
+// FixedRevisitPolicy visits the URLs again at a fixed interval.
+type FixedRevisitPolicy struct {
+	Interval time.Duration
+}
+
+// RevisitAfter returns the fixed interval.
+func (fp *FixedRevisitPolicy) RevisitAfter(ctx *URLContext, vi *VisitInfo) time.Duration {
+	return fp.Interval
+}
+
+// AdaptiveRevisitPolicy adapts the revisit interval of each URL to its
+// observed change frequency: the interval is divided by the Factor when the
+// content changed since the previous visit, and multiplied by the Factor
+// when it did not, within the MinInterval and MaxInterval bounds. Zero
+// fields use the default values.
+type AdaptiveRevisitPolicy struct {
+	MinInterval     time.Duration
+	MaxInterval     time.Duration
+	InitialInterval time.Duration
+	Factor          float64
+}
+
+// RevisitAfter returns the adapted interval.
+func (ap *AdaptiveRevisitPolicy) RevisitAfter(ctx *URLContext, vi *VisitInfo) time.Duration {
+	min, max, d, f := ap.MinInterval, ap.MaxInterval, ap.InitialInterval, ap.Factor
+	if min <= 0 {
+		min = DefaultRevisitMinInterval
+	}
+	if max <= 0 {
+		max = DefaultRevisitMaxInterval
+	}
+	if d <= 0 {
+		d = DefaultRevisitInitialInterval
+	}
+	if f <= 1 {
+		f = DefaultRevisitFactor
+	}
+
+	if vi.Interval > 0 {
+		if vi.Changed {
+			d = time.Duration(float64(vi.Interval) / f)
+		} else {
+			d = time.Duration(float64(vi.Interval) * f)
+		}
+	}
+	if d < min {
+		d = min
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// The visit schedule of a visited URL, the value of the Crawler's visited
+// map. It is nil for URLs that are not visited yet or that are not
+// scheduled for a revisit.
+type visitSchedule struct {
+	ctx   *URLContext
+	next  time.Time
+	hash  []byte
+	info  VisitInfo
+	index int
+}
+
+// Update the visit information with the response of the worker, and
+// schedule the next visit according to the policy.
+func (c *Crawler) scheduleRevisit(res *workerResponse) {
+	key := res.ctx.normalizedURL.String()
+	vs := c.visited[key]
+	if vs == nil {
+		vs = &visitSchedule{index: -1}
+		c.visited[key] = vs
+	}
+
+	vs.info.LastVisit = time.Now()
+	vs.info.Visits++
+	vs.info.Changed = !res.ctx.notModified && (vs.hash == nil || !bytes.Equal(vs.hash, res.ctx.contentHash))
+	if vs.info.Changed {
+		vs.info.Changes++
+	}
+	if res.ctx.contentHash != nil {
+		vs.hash = res.ctx.contentHash
+	}
+
+	d := c.Options.RevisitPolicy.RevisitAfter(res.ctx, &vs.info)
+	vs.info.Interval = d
+	if d <= 0 {
+		return
+	}
+	vs.ctx = res.ctx.cloneForRevisit()
+	vs.next = vs.info.LastVisit.Add(d)
+	c.revisits.schedule(vs)
+	c.logFunc(LogTrace, "revisit %s in %v", res.ctx.url, d, urlAttr(res.ctx.url), durationAttr(d))
+}
+
+// Schedule a failed revisit (fetch error, error status code, disallowed or
+// duplicate) again after the previous interval, so that the URL is not
+// dropped from the schedule. The failure is not a visit, the visit
+// information is unchanged.
+func (c *Crawler) rescheduleRevisit(res *workerResponse) {
+	vs := c.visited[res.ctx.normalizedURL.String()]
+	if vs == nil || vs.info.Interval <= 0 || vs.index >= 0 {
+		// Not a revisit, or already scheduled
+		return
+	}
+	vs.ctx = res.ctx.cloneForRevisit()
+	vs.next = time.Now().Add(vs.info.Interval)
+	c.revisits.schedule(vs)
+	c.logFunc(LogTrace, "revisit %s in %v after a failed visit", res.ctx.url, vs.info.Interval, urlAttr(res.ctx.url), durationAttr(vs.info.Interval))
+}
+
+// Stack the URLs that are due for a revisit.
+func (c *Crawler) stackRevisits(now time.Time) {
+	for c.revisits.Len() > 0 && !c.revisits.items[0].next.After(now) {
+		vs := heap.Pop(&c.revisits).(*visitSchedule)
+		c.logFunc(LogInfo, "revisit: %s", vs.ctx.url, urlAttr(vs.ctx.url))
+		c.stackURL(vs.ctx)
+		vs.ctx = nil
+	}
+}
+
+// The revisit queue orders the scheduled URLs by time of the next visit.
+type revisitQueue struct {
+	items []*visitSchedule
+}
+
+// Schedule or re-schedule the URL.
+func (q *revisitQueue) schedule(vs *visitSchedule) {
+	if vs.index >= 0 {
+		heap.Fix(q, vs.index)
+	} else {
+		heap.Push(q, vs)
+	}
+}
+
+// Returns the time until the next revisit, and false if there is none.
+func (q *revisitQueue) nextIn(now time.Time) (time.Duration, bool) {
+	if len(q.items) == 0 {
+		return 0, false
+	}
+	return q.items[0].next.Sub(now), true
+}
+
+// Len implements sort.Interface for heap.Interface.
+func (q *revisitQueue) Len() int {
+	return len(q.items)
+}
+
+// Less implements sort.Interface for heap.Interface.
+func (q *revisitQueue) Less(i, j int) bool {
+	return q.items[i].next.Before(q.items[j].next)
+}
+
+// Swap implements sort.Interface for heap.Interface.
+func (q *revisitQueue) Swap(i, j int) {
+	q.items[i], q.items[j] = q.items[j], q.items[i]
+	q.items[i].index = i
+	q.items[j].index = j
+}
+
+// Push implements heap.Interface, use schedule instead.
+func (q *revisitQueue) Push(x interface{}) {
+	vs := x.(*visitSchedule)
+	vs.index = len(q.items)
+	q.items = append(q.items, vs)
+}
+
+// Pop implements heap.Interface.
+func (q *revisitQueue) Pop() interface{} {
+	n := len(q.items)
+	vs := q.items[n-1]
+	q.items[n-1] = nil
+	q.items = q.items[:n-1]
+	vs.index = -1
+	return vs
+}
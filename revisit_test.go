@@ -0,0 +1,202 @@
+package gocrawl
+
+import (
+	"container/heap"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRevisitPolicy(t *testing.T) {
+	ap := &AdaptiveRevisitPolicy{
+		MinInterval:     time.Minute,
+		MaxInterval:     time.Hour,
+		InitialInterval: 10 * time.Minute,
+		Factor:          2,
+	}
+	cases := []struct {
+		vi   VisitInfo
+		want time.Duration
+	}{
+		{VisitInfo{Visits: 1, Changed: true}, 10 * time.Minute},
+		{VisitInfo{Changed: true, Interval: 10 * time.Minute}, 5 * time.Minute},
+		{VisitInfo{Changed: false, Interval: 10 * time.Minute}, 20 * time.Minute},
+		{VisitInfo{Changed: true, Interval: time.Minute}, time.Minute},
+		{VisitInfo{Changed: false, Interval: 50 * time.Minute}, time.Hour},
+	}
+	for i, c := range cases {
+		if got := ap.RevisitAfter(nil, &c.vi); got != c.want {
+			t.Errorf("%d: want %v, got %v", i, c.want, got)
+		}
+	}
+}
+
+func TestRevisitQueue(t *testing.T) {
+	var q revisitQueue
+
+	now := time.Now()
+	a := &visitSchedule{next: now.Add(3 * time.Second), index: -1}
+	b := &visitSchedule{next: now.Add(time.Second), index: -1}
+	c := &visitSchedule{next: now.Add(2 * time.Second), index: -1}
+	q.schedule(a)
+	q.schedule(b)
+	q.schedule(c)
+
+	// Re-schedule a before b
+	a.next = now
+	q.schedule(a)
+	if d, ok := q.nextIn(now); !ok || d != 0 {
+		t.Errorf("expected the next revisit now, got %v, %v", d, ok)
+	}
+	for i, want := range []*visitSchedule{a, b, c} {
+		if got := heap.Pop(&q).(*visitSchedule); got != want || got.index != -1 {
+			t.Errorf("%d: unexpected schedule order", i)
+		}
+	}
+	if _, ok := q.nextIn(now); ok {
+		t.Error("expected no more revisits")
+	}
+}
+
+type recordingRevisitPolicy struct {
+	mu     sync.Mutex
+	infos  []VisitInfo
+	policy RevisitPolicy
+}
+
+func (rp *recordingRevisitPolicy) RevisitAfter(ctx *URLContext, vi *VisitInfo) time.Duration {
+	rp.mu.Lock()
+	rp.infos = append(rp.infos, *vi)
+	rp.mu.Unlock()
+	return rp.policy.RevisitAfter(ctx, vi)
+}
+
+func TestRevisit(t *testing.T) {
+	var cnt int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		// The content changes on every other request
+		n := atomic.AddInt32(&cnt, 1)
+		fmt.Fprintf(w, "<html><body>%d</body></html>", (n+1)/2)
+	}))
+	defer srv.Close()
+
+	rp := &recordingRevisitPolicy{policy: &FixedRevisitPolicy{Interval: 10 * time.Millisecond}}
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.MaxVisits = 4
+	opts.RevisitPolicy = rp
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	if err := c.Run(srv.URL + "/"); err != ErrMaxVisits {
+		t.Fatalf("expected ErrMaxVisits, got %v", err)
+	}
+	assertCallCount(spy, "Revisit", eMKVisit, 4, t)
+	assertIsInLog("Revisit", spy.b, "revisit: "+srv.URL+"/", t)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	// The 4th visit reaches MaxVisits once it is scheduled, so that it is
+	// saved in the Frontier
+	if len(rp.infos) != 4 {
+		t.Fatalf("expected 4 scheduled visits, got %d", len(rp.infos))
+	}
+	for i, want := range []bool{true, false, true, false} {
+		vi := rp.infos[i]
+		if vi.Visits != i+1 || vi.Changed != want {
+			t.Errorf("%d: want visit %d changed %v, got %+v", i, i+1, want, vi)
+		}
+	}
+	if rp.infos[2].Changes != 2 {
+		t.Errorf("expected 2 changes, got %d", rp.infos[2].Changes)
+	}
+}
+
+func TestRevisitDuplicate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "<html><body>%s</body></html>", dupText)
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.MaxVisits = 3
+	opts.RevisitPolicy = &FixedRevisitPolicy{Interval: 10 * time.Millisecond}
+	opts.DuplicateDetector = NewDuplicateDetector()
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	// The unchanged page is not a duplicate of itself when revisited
+	if err := c.Run(srv.URL + "/"); err != ErrMaxVisits {
+		t.Fatalf("expected ErrMaxVisits, got %v", err)
+	}
+	assertCallCount(spy, "RevisitDuplicate", eMKVisit, 3, t)
+	assertIsNotInLog("RevisitDuplicate", spy.b, "ignore on duplicate content policy", t)
+}
+
+func TestRevisitFailed(t *testing.T) {
+	var cnt int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		// The first revisit fails
+		if atomic.AddInt32(&cnt, 1) == 2 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.MaxVisits = 2
+	opts.RevisitPolicy = &FixedRevisitPolicy{Interval: 10 * time.Millisecond}
+	c := NewCrawlerWithOptions(opts)
+
+	// The URL stays scheduled after the failed revisit
+	if err := c.Run(srv.URL + "/"); err != ErrMaxVisits {
+		t.Fatalf("expected ErrMaxVisits, got %v", err)
+	}
+	assertCallCount(spy, "RevisitFailed", eMKVisit, 2, t)
+	assertCallCount(spy, "RevisitFailed", eMKError, 1, t)
+	if n := atomic.LoadInt32(&cnt); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRevisitNone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.RevisitPolicy = &FixedRevisitPolicy{}
+	c := NewCrawlerWithOptions(opts)
+
+	// No revisit scheduled, the crawl ends normally
+	if err := c.Run(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	assertCallCount(spy, "RevisitNone", eMKVisit, 1, t)
+}
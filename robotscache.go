@@ -0,0 +1,171 @@
+package gocrawl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RobotsCache is the interface required to cache the robots.txt content of
+// the hosts, keyed by the normalized robots.txt URL, so that it is not
+// fetched on each run of the crawler. Get returns the cached content if it
+// is present and not expired. A missing entry only costs a fetch of the
+// robots.txt, so Set does not report errors. The DefaultExtender uses a
+// RobotsCache, if one is set, in its RequestRobots and FetchedRobots
+// methods. Implementations must be safe for concurrent use, the workers of
+// all hosts share the cache.
+type RobotsCache interface {
+	Get(robotsURL string) (data []byte, ok bool)
+	Set(robotsURL string, data []byte, expires time.Time)
+}
+
+// A cached robots.txt content.
+type robotsCacheEntry struct {
+	URL     string
+	Data    []byte
+	Expires time.Time
+}
+
+// MemoryRobotsCache is a RobotsCache that keeps the robots.txt content in a
+// map, the expired entries are removed when they are read. Use the same
+// cache for the crawlers of a process to fetch each robots.txt once a day.
+type MemoryRobotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsCacheEntry
+}
+
+// NewMemoryRobotsCache returns an empty MemoryRobotsCache.
+func NewMemoryRobotsCache() *MemoryRobotsCache {
+	return &MemoryRobotsCache{entries: make(map[string]*robotsCacheEntry)}
+}
+
+// Get returns the cached robots.txt content of the URL, if it is not expired.
+func (mc *MemoryRobotsCache) Get(robotsURL string) ([]byte, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	e, ok := mc.entries[robotsURL]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(e.Expires) {
+		delete(mc.entries, robotsURL)
+		return nil, false
+	}
+	return e.Data, true
+}
+
+// Set caches the robots.txt content of the URL until it expires.
+func (mc *MemoryRobotsCache) Set(robotsURL string, data []byte, expires time.Time) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.entries[robotsURL] = &robotsCacheEntry{robotsURL, data, expires}
+}
+
+// DiskRobotsCache is a RobotsCache that saves the robots.txt content in
+// files in a directory, so that it can be shared by multiple processes
+// and survive restarts.
+type DiskRobotsCache struct {
+	dir string
+}
+
+// NewDiskRobotsCache returns a DiskRobotsCache that saves the files in the
+// specified directory, which must exist.
+func NewDiskRobotsCache(dir string) *DiskRobotsCache {
+	return &DiskRobotsCache{dir}
+}
+
+// Get returns the cached robots.txt content of the URL, if it is not expired.
+func (dc *DiskRobotsCache) Get(robotsURL string) ([]byte, bool) {
+	p := dc.path(robotsURL)
+	var e robotsCacheEntry
+	if err := readGobFile(p, &e); err != nil || e.URL != robotsURL {
+		return nil, false
+	}
+	if !time.Now().Before(e.Expires) {
+		os.Remove(p)
+		return nil, false
+	}
+	return e.Data, true
+}
+
+// Set saves the robots.txt content of the URL until it expires, in a file
+// named after the SHA-1 hash of the URL. Nothing is cached if the file
+// cannot be written.
+func (dc *DiskRobotsCache) Set(robotsURL string, data []byte, expires time.Time) {
+	writeGobFile(dc.path(robotsURL), &robotsCacheEntry{robotsURL, data, expires})
+}
+
+func (dc *DiskRobotsCache) path(robotsURL string) string {
+	return hashedPath(dc.dir, robotsURL, ".robots")
+}
+
+// Read the robots.txt response and cache it, if it may be cached. Server
+// errors are not cached, and a 4xx status code is cached as an empty
+// robots.txt (no restriction). The body is rewound so that it can be read
+// again.
+func cacheRobotsResponse(rc RobotsCache, ctx *URLContext, res *http.Response) {
+	if isRobotsUnreachable(res.StatusCode) {
+		return
+	}
+	expires, ok := robotsCacheExpiry(res.Header, time.Now())
+	if !ok {
+		return
+	}
+
+	var data []byte
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		var err error
+		if data, err = ioutil.ReadAll(res.Body); err != nil {
+			return
+		}
+		res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	rc.Set(ctx.normalizedURL.String(), data, expires)
+}
+
+// Get the expiration time of the robots.txt from the HTTP cache headers. It
+// is at most robotsMaxAge, which is also the default. It returns false if
+// the response must not be cached.
+func robotsCacheExpiry(h http.Header, now time.Time) (time.Time, bool) {
+	maxAge := robotsMaxAge
+
+	if cc := h.Get("Cache-Control"); cc != "" {
+		for _, d := range strings.Split(cc, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			switch {
+			case d == "no-store" || d == "no-cache":
+				return time.Time{}, false
+			case strings.HasPrefix(d, "max-age="):
+				if secs, err := strconv.Atoi(d[len("max-age="):]); err == nil {
+					if age := time.Duration(secs) * time.Second; age < maxAge {
+						maxAge = age
+					}
+					return now.Add(maxAge), maxAge > 0
+				}
+			}
+		}
+	}
+
+	if exp := h.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		if err != nil {
+			// An invalid Expires means already expired
+			return time.Time{}, false
+		}
+		// Relative to the server's clock, if available
+		base := now
+		if d, err := http.ParseTime(h.Get("Date")); err == nil {
+			base = d
+		}
+		if age := t.Sub(base); age < maxAge {
+			maxAge = age
+		}
+	}
+	return now.Add(maxAge), maxAge > 0
+}
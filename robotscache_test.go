@@ -0,0 +1,91 @@
+package gocrawl
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testRobotsCache(t *testing.T, rc RobotsCache) {
+	if _, ok := rc.Get("http://host/robots.txt"); ok {
+		t.Fatal("expected a cache miss")
+	}
+	rc.Set("http://host/robots.txt", []byte("User-agent: *"), time.Now().Add(time.Hour))
+	rc.Set("http://other/robots.txt", []byte("Disallow: /"), time.Now().Add(-time.Second))
+
+	if data, ok := rc.Get("http://host/robots.txt"); !ok || string(data) != "User-agent: *" {
+		t.Errorf("expected a cache hit, got %q, %v", data, ok)
+	}
+	if _, ok := rc.Get("http://other/robots.txt"); ok {
+		t.Error("expected an expired entry to be a cache miss")
+	}
+}
+
+func TestMemoryRobotsCache(t *testing.T) {
+	testRobotsCache(t, NewMemoryRobotsCache())
+}
+
+func TestDiskRobotsCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawl-robots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testRobotsCache(t, NewDiskRobotsCache(dir))
+	// A new instance on the same directory sees the cached content
+	if _, ok := NewDiskRobotsCache(dir).Get("http://host/robots.txt"); !ok {
+		t.Error("expected a cache hit from a new instance")
+	}
+}
+
+func TestRobotsCacheExpiry(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		h    http.Header
+		want time.Duration
+		ok   bool
+	}{
+		{http.Header{}, robotsMaxAge, true},
+		{http.Header{"Cache-Control": {"public, max-age=3600"}}, time.Hour, true},
+		{http.Header{"Cache-Control": {"max-age=864000"}}, robotsMaxAge, true},
+		{http.Header{"Cache-Control": {"max-age=0"}}, 0, false},
+		{http.Header{"Cache-Control": {"no-store"}}, 0, false},
+		{http.Header{"Cache-Control": {"no-cache"}}, 0, false},
+		{http.Header{
+			"Date":    {"Fri, 01 Jan 2021 10:00:00 GMT"},
+			"Expires": {"Fri, 01 Jan 2021 12:00:00 GMT"},
+		}, 2 * time.Hour, true},
+		{http.Header{"Expires": {"0"}}, 0, false},
+	}
+	for i, c := range cases {
+		got, ok := robotsCacheExpiry(c.h, now)
+		if ok != c.ok || (ok && got.Sub(now) != c.want) {
+			t.Errorf("%d: want %v, %v, got %v, %v", i, c.want, c.ok, got.Sub(now), ok)
+		}
+	}
+}
+
+func TestDefaultExtenderRobotsCache(t *testing.T) {
+	srv, cnt := newRobotsServer("User-agent: *\nDisallow: /b\n", http.StatusOK)
+	defer srv.Close()
+
+	ext := &DefaultExtender{RobotsCache: NewMemoryRobotsCache()}
+	for i := 0; i < 2; i++ {
+		spy := newSpy(ext, true)
+		opts := NewOptions(spy)
+		opts.CrawlDelay = 0
+		opts.LogFlags = LogAll
+		c := NewCrawlerWithOptions(opts)
+		c.Run(srv.URL + "/")
+
+		assertCallCount(spy, "RobotsCache", eMKVisit, 2, t)
+		assertCallCount(spy, "RobotsCache", eMKDisallowed, 1, t)
+	}
+	if n := atomic.LoadInt32(cnt); n != 1 {
+		t.Errorf("expected 1 robots.txt request, got %d", n)
+	}
+}
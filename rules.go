@@ -0,0 +1,176 @@
+package gocrawl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RuleTarget is the part of the URL matched by a URLRule.
+type RuleTarget int
+
+// The rule targets, matched against the normalized URL.
+const (
+	// RulePath matches the (unescaped) path of the URL.
+	RulePath RuleTarget = iota
+
+	// RuleQuery matches the raw query of the URL, without the "?".
+	RuleQuery
+
+	// RuleURL matches the whole URL.
+	RuleURL
+)
+
+// URLRule is a declarative rule that includes or excludes the URLs to
+// enqueue, see Options.IncludeRules and Options.ExcludeRules. Exactly one of
+// Regexp and Glob must be set.
+type URLRule struct {
+	// Name identifies the rule in the logs. If empty, the pattern is used.
+	Name string
+
+	// Target is the part of the URL matched by the rule.
+	Target RuleTarget
+
+	// Regexp is a regular expression that matches the target if it is
+	// found anywhere in it (it must be anchored to match the whole target).
+	Regexp string
+
+	// Glob is a pattern that must match the whole target, where "*"
+	// matches any sequence of characters except "/", "**" matches any
+	// sequence of characters, and "?" matches any character except "/".
+	Glob string
+}
+
+// A URLRule compiled to a regular expression.
+type urlRule struct {
+	name   string
+	target RuleTarget
+	re     *regexp.Regexp
+}
+
+func (r *urlRule) match(ctx *URLContext) bool {
+	u := ctx.normalizedURL
+	switch r.target {
+	case RuleQuery:
+		return r.re.MatchString(u.RawQuery)
+	case RuleURL:
+		return r.re.MatchString(u.String())
+	}
+	return r.re.MatchString(u.Path)
+}
+
+// Compile the rules, returning an error if a rule is invalid.
+func compileURLRules(rules []*URLRule) ([]*urlRule, error) {
+	res := make([]*urlRule, 0, len(rules))
+	for _, r := range rules {
+		var pat string
+		switch {
+		case r.Regexp != "" && r.Glob != "":
+			return nil, fmt.Errorf("invalid URL rule %s: both Regexp and Glob are set", r.Name)
+		case r.Regexp != "":
+			pat = r.Regexp
+		case r.Glob != "":
+			pat = globToRegexp(r.Glob)
+		default:
+			return nil, fmt.Errorf("invalid URL rule %s: no Regexp nor Glob", r.Name)
+		}
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL rule %s: %s", r.Name, err)
+		}
+
+		name := r.Name
+		if name == "" {
+			name = r.Regexp + r.Glob
+		}
+		res = append(res, &urlRule{name, r.Target, re})
+	}
+	return res, nil
+}
+
+// Convert the glob pattern to an anchored regular expression.
+func globToRegexp(glob string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				buf.WriteString(".*")
+				i++
+			} else {
+				buf.WriteString("[^/]*")
+			}
+		case '?':
+			buf.WriteString("[^/]")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
+
+// Initialize the path prefixes of the seeds, for Options.SeedPathPrefix. The
+// prefix of a seed is the directory of its path, e.g. "/docs/" for both
+// "/docs/" and "/docs/index.html".
+func (c *Crawler) initSeedPrefixes(ctxs []*URLContext) {
+	c.seedPrefixes = nil
+	if !c.Options.SeedPathPrefix {
+		return
+	}
+	c.seedPrefixes = make(map[string][]string, len(ctxs))
+	for _, ctx := range ctxs {
+		p := ctx.normalizedURL.Path
+		p = p[:strings.LastIndex(p, "/")+1]
+		if p == "" {
+			p = "/"
+		}
+		host := ctx.normalizedURL.Host
+		c.seedPrefixes[host] = append(c.seedPrefixes[host], p)
+	}
+}
+
+// Check the URL against the declarative rules of the Options, and return
+// the name of the rule that rejects it, or an empty string if it is
+// accepted.
+func (c *Crawler) checkURLRules(ctx *URLContext) string {
+	u := ctx.normalizedURL
+	if c.Options.MaxURLLength > 0 && len(u.String()) > c.Options.MaxURLLength {
+		return "max-url-length"
+	}
+	if c.Options.MaxQueryParams > 0 && u.RawQuery != "" &&
+		len(strings.FieldsFunc(u.RawQuery, isQuerySeparator)) > c.Options.MaxQueryParams {
+		return "max-query-params"
+	}
+	if prefixes, ok := c.seedPrefixes[u.Host]; ok {
+		var found bool
+		for _, p := range prefixes {
+			if strings.HasPrefix(u.Path, p) || u.Path+"/" == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "seed-path-prefix"
+		}
+	}
+	for _, r := range c.excludeRules {
+		if r.match(ctx) {
+			return r.name
+		}
+	}
+	if len(c.includeRules) > 0 {
+		for _, r := range c.includeRules {
+			if r.match(ctx) {
+				return ""
+			}
+		}
+		return "include"
+	}
+	return ""
+}
+
+func isQuerySeparator(r rune) bool {
+	return r == '&' || r == ';'
+}
@@ -0,0 +1,108 @@
+package gocrawl
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := []struct {
+		glob  string
+		in    []string
+		notIn []string
+	}{
+		{"/docs/*", []string{"/docs/", "/docs/a.html"}, []string{"/docs/a/b.html", "/docs", "/x/docs/a"}},
+		{"/docs/**", []string{"/docs/a/b.html"}, []string{"/doc/a"}},
+		{"/page?.html", []string{"/page1.html"}, []string{"/page10.html", "/page/.html"}},
+		{"**.pdf", []string{"/a/b.pdf"}, []string{"/a/bpdf", "/a.pdf/b"}},
+		{"sessionid=*", []string{"sessionid=abc"}, []string{"a=b&sessionid=abc"}},
+	}
+	for _, c := range cases {
+		re := regexp.MustCompile(globToRegexp(c.glob))
+		for _, s := range c.in {
+			if !re.MatchString(s) {
+				t.Errorf("%s: expected %s to match", c.glob, s)
+			}
+		}
+		for _, s := range c.notIn {
+			if re.MatchString(s) {
+				t.Errorf("%s: expected %s not to match", c.glob, s)
+			}
+		}
+	}
+}
+
+func TestCompileURLRulesErrors(t *testing.T) {
+	cases := [][]*URLRule{
+		{{Name: "none"}},
+		{{Name: "both", Regexp: "a", Glob: "b"}},
+		{{Name: "invalid", Regexp: "(a"}},
+	}
+	for _, rules := range cases {
+		if _, err := compileURLRules(rules); err == nil {
+			t.Errorf("%s: expected an error", rules[0].Name)
+		}
+	}
+
+	c := NewCrawler(new(DefaultExtender))
+	c.Options.ExcludeRules = cases[2]
+	if err := c.Run("http://host/"); err == nil {
+		t.Error("expected Run to fail with an invalid rule")
+	}
+}
+
+func TestCheckURLRules(t *testing.T) {
+	opts := &Options{
+		IncludeRules: []*URLRule{
+			{Name: "html", Glob: "**.html"},
+			{Name: "dirs", Regexp: "/$"},
+		},
+		ExcludeRules: []*URLRule{
+			{Name: "private", Glob: "/private/**"},
+			{Name: "session", Target: RuleQuery, Regexp: `(^|&)sid=`},
+			{Target: RuleURL, Regexp: `^https://`},
+		},
+		SeedPathPrefix: true,
+		MaxURLLength:   40,
+		MaxQueryParams: 2,
+	}
+	c := &Crawler{Options: opts}
+	var err error
+	if c.includeRules, err = compileURLRules(opts.IncludeRules); err != nil {
+		t.Fatal(err)
+	}
+	if c.excludeRules, err = compileURLRules(opts.ExcludeRules); err != nil {
+		t.Fatal(err)
+	}
+	var seeds []*URLContext
+	for _, s := range []string{"http://host/", "http://docs/v1/index.html"} {
+		u, _ := url.Parse(s)
+		seeds = append(seeds, newURLContext(u, nil, opts))
+	}
+	c.initSeedPrefixes(seeds)
+
+	cases := []struct {
+		url  string
+		rule string
+	}{
+		{"http://host/", ""},
+		{"http://host/a/b.html?x=1&y=2", ""},
+		{"http://host/a/b.html?x=1&y=2&z=3", "max-query-params"},
+		{"http://host/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.html", "max-url-length"},
+		{"http://host/private/a.html", "private"},
+		{"http://host/a.html?x=1&sid=2", "session"},
+		{"https://host/a.html", `^https://`},
+		{"http://host/a.pdf", "include"},
+		{"http://docs/v1/a.html", ""},
+		{"http://docs/v1/", ""},
+		{"http://docs/v2/a.html", "seed-path-prefix"},
+		{"http://other/a.html", ""},
+	}
+	for _, tc := range cases {
+		u, _ := url.Parse(tc.url)
+		if got := c.checkURLRules(newURLContext(u, nil, opts)); got != tc.rule {
+			t.Errorf("%s: want rule %q, got %q", tc.url, tc.rule, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package gocrawl
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ScopeMode defines which hosts are in the scope of the crawl, see
+// Options.Scope.
+type ScopeMode int
+
+// The scope modes. Except for ScopeDefault and ScopeAll, the scope is
+// relative to the hosts of the seed URLs passed to Run, and the host names
+// are compared without case and without the default port of the scheme.
+const (
+	// ScopeDefault uses Options.SameHostOnly: if set, only the URLs with the
+	// same host (including the port) as their source URL, or as a seed URL
+	// if they have no source, are in scope. Otherwise all URLs are in scope.
+	ScopeDefault ScopeMode = iota
+
+	// ScopeAll allows all hosts.
+	ScopeAll
+
+	// ScopeExactHost allows the hosts of the seed URLs, e.g. a seed of
+	// example.com allows example.com:80 and example.com:443, but not
+	// www.example.com.
+	ScopeExactHost
+
+	// ScopeRegistrableDomain allows the hosts that have the same registrable
+	// domain (the effective top-level domain plus one label, based on the
+	// public suffix list) as a seed URL, e.g. a seed of www.example.co.uk
+	// allows example.co.uk and blog.example.co.uk.
+	ScopeRegistrableDomain
+
+	// ScopeSubdomains allows the hosts of the seed URLs and their
+	// subdomains, e.g. a seed of example.com allows www.example.com and
+	// a.b.example.com, but a seed of www.example.com does not allow
+	// example.com.
+	ScopeSubdomains
+
+	// ScopeHostList allows only the hosts listed in Options.AllowedHosts,
+	// regardless of the seed URLs.
+	ScopeHostList
+)
+
+var scopeModeNames = [...]string{
+	ScopeDefault:           "default",
+	ScopeAll:               "all",
+	ScopeExactHost:         "exact-host",
+	ScopeRegistrableDomain: "registrable-domain",
+	ScopeSubdomains:        "subdomains",
+	ScopeHostList:          "host-list",
+}
+
+// String returns the name of the scope mode.
+func (m ScopeMode) String() string {
+	if m >= 0 && int(m) < len(scopeModeNames) {
+		return scopeModeNames[m]
+	}
+	return "unknown"
+}
+
+// Initialize the hosts in scope from the seed URLs, or from
+// Options.AllowedHosts, based on the scope mode.
+func (c *Crawler) initScope(ctxs []*URLContext) {
+	c.scopeHosts = make(map[string]struct{})
+	switch c.Options.Scope {
+	case ScopeExactHost:
+		for _, ctx := range ctxs {
+			c.scopeHosts[hostKey(ctx.normalizedURL)] = struct{}{}
+		}
+	case ScopeSubdomains:
+		for _, ctx := range ctxs {
+			c.scopeHosts[strings.ToLower(ctx.normalizedURL.Hostname())] = struct{}{}
+		}
+	case ScopeRegistrableDomain:
+		for _, ctx := range ctxs {
+			c.scopeHosts[registrableDomain(ctx.normalizedURL.Hostname())] = struct{}{}
+		}
+	case ScopeHostList:
+		for _, h := range c.Options.AllowedHosts {
+			if u, err := url.Parse("//" + h); err == nil {
+				c.scopeHosts[hostKey(u)] = struct{}{}
+			}
+		}
+	}
+}
+
+// Check if the URL is in the scope of the crawl. ScopeDefault is checked
+// by the same host policy, so it is always in scope.
+func (c *Crawler) isInScope(ctx *URLContext) bool {
+	u := ctx.normalizedURL
+	switch c.Options.Scope {
+	case ScopeExactHost, ScopeHostList:
+		_, ok := c.scopeHosts[hostKey(u)]
+		return ok
+	case ScopeRegistrableDomain:
+		_, ok := c.scopeHosts[registrableDomain(u.Hostname())]
+		return ok
+	case ScopeSubdomains:
+		h := strings.ToLower(u.Hostname())
+		for {
+			if _, ok := c.scopeHosts[h]; ok {
+				return true
+			}
+			i := strings.Index(h, ".")
+			if i < 0 {
+				return false
+			}
+			h = h[i+1:]
+		}
+	}
+	return true
+}
+
+// Get the lowercase host name of the URL, with its port only if it is not
+// the default port of the scheme (80 and 443 are both default ports if there
+// is no scheme).
+func hostKey(u *url.URL) string {
+	h := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" || (port == "80" && u.Scheme != "https") || (port == "443" && u.Scheme != "http") {
+		return h
+	}
+	return net.JoinHostPort(h, port)
+}
+
+// Get the registrable domain of the host name, or the host name itself if
+// it has none (e.g. an IP address or a single-label host).
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	if d, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return d
+	}
+	return host
+}
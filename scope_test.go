@@ -0,0 +1,70 @@
+package gocrawl
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScope(t *testing.T) {
+	cases := []struct {
+		mode    ScopeMode
+		allowed []string
+		seeds   []string
+		in      []string
+		out     []string
+	}{
+		{
+			ScopeAll, nil, []string{"http://example.com/"},
+			[]string{"http://example.com/a", "http://other.org/a"},
+			nil,
+		},
+		{
+			ScopeExactHost, nil, []string{"http://example.com/"},
+			[]string{"http://example.com/a", "http://example.com:80/a", "https://example.com:443/a", "https://EXAMPLE.com/a"},
+			[]string{"http://www.example.com/a", "http://example.com:8080/a", "http://example.com:443/a", "http://other.org/a"},
+		},
+		{
+			ScopeRegistrableDomain, nil, []string{"http://www.example.co.uk/"},
+			[]string{"http://example.co.uk/a", "https://blog.example.co.uk:8443/a", "http://a.b.example.co.uk/a"},
+			[]string{"http://other.co.uk/a", "http://co.uk/a", "http://example.com/a"},
+		},
+		{
+			ScopeRegistrableDomain, nil, []string{"http://127.0.0.1:8080/", "http://localhost/"},
+			[]string{"http://127.0.0.1/a", "http://localhost:8080/a"},
+			[]string{"http://127.0.0.2/a", "http://www.localhost/a"},
+		},
+		{
+			ScopeSubdomains, nil, []string{"http://example.com/", "http://www.test.org/"},
+			[]string{"http://example.com/a", "http://www.example.com/a", "https://a.b.example.com/a", "http://www.test.org/a", "http://a.www.test.org/a"},
+			[]string{"http://test.org/a", "http://myexample.com/a", "http://example.com.evil.org/a"},
+		},
+		{
+			ScopeHostList, []string{"example.com", "www.test.org:8080", "other.org:443"}, []string{"http://seed.com/"},
+			[]string{"http://example.com/a", "https://example.com/a", "http://www.test.org:8080/a", "https://other.org/a", "http://other.org/a"},
+			[]string{"http://seed.com/a", "http://www.example.com/a", "http://www.test.org/a"},
+		},
+	}
+
+	for _, c := range cases {
+		cr := &Crawler{Options: &Options{Scope: c.mode, AllowedHosts: c.allowed}}
+		var seeds []*URLContext
+		for _, s := range c.seeds {
+			u, _ := url.Parse(s)
+			seeds = append(seeds, newURLContext(u, nil, cr.Options))
+		}
+		cr.initScope(seeds)
+
+		for _, s := range c.in {
+			u, _ := url.Parse(s)
+			if !cr.isInScope(newURLContext(u, nil, cr.Options)) {
+				t.Errorf("%s: expected %s to be in scope", c.mode, s)
+			}
+		}
+		for _, s := range c.out {
+			u, _ := url.Parse(s)
+			if cr.isInScope(newURLContext(u, nil, cr.Options)) {
+				t.Errorf("%s: expected %s to be out of scope", c.mode, s)
+			}
+		}
+	}
+}
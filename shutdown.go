@@ -0,0 +1,151 @@
+package gocrawl
+
+import (
+	"context"
+)
+
+// Shutdown gracefully stops the crawler: no new URL is stacked on the
+// workers, the URLs being fetched are processed (Visited is called as
+// usual), and the workers hand their queued URLs back to the crawler
+// instead of fetching them. It waits for the crawl to end, in which case Run
+// returns ErrShutdown, and returns the URLs that were not visited: the URLs
+// that were waiting in the workers' queues (including the URLs waiting for
+// a retry) and the URLs harvested or enqueued while draining, provided they
+// comply with the selection policies. If Options.Store is set, they are
+// also saved as pending URLs in the final checkpoint, so that they are
+// visited when the crawl resumes. URLs scheduled for a revisit are not
+// returned, they remain in the Store's Frontier.
+//
+// If the provided context is done before the crawl ends, the crawler is
+// stopped as if Stop was called (requests in progress are aborted, and Run
+// returns ErrInterrupted), and the context's error is returned along with
+// the URLs that were not visited. It returns ErrNotRunning if the crawler
+// has not started. If the crawl has already ended, it returns immediately.
+func (c *Crawler) Shutdown(ctx context.Context) ([]*URLContext, error) {
+	c.mu.Lock()
+	shutdown, done := c.shutdown, c.done
+	if shutdown != nil {
+		select {
+		case <-shutdown:
+		default:
+			close(shutdown)
+		}
+	}
+	c.mu.Unlock()
+
+	if done == nil {
+		return nil, ErrNotRunning
+	}
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.Stop()
+		<-done
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.unvisited, err
+}
+
+// Switch the crawler to the drain mode: the URLs are not stacked on the
+// workers anymore, and the workers hand their queued URLs back.
+func (c *Crawler) startDrain() {
+	c.logFunc(LogInfo, "shutting down, draining workers...")
+	c.draining = true
+	close(c.drain)
+}
+
+// Keep the URL as not visited, instead of stacking it on its worker. It is
+// kept in the pending URLs so that it is saved in the Frontier, and it is
+// marked as visited so that it is kept only once.
+func (c *Crawler) drainURL(ctx *URLContext) {
+	if ctx.sitemap {
+		// Not a page, it is not returned as unvisited
+		return
+	}
+	c.drained = append(c.drained, ctx)
+	c.pending[ctx] = struct{}{}
+	c.visited[ctx.normalizedURL.String()] = nil
+	c.logFunc(LogTrace, "drained: %s", ctx.url, urlAttr(ctx.url))
+}
+
+// Save the URLs that were not visited on shutdown, so that Shutdown can
+// return them. If the crawler was stopped while draining, the URLs that
+// were still stacked on the workers are added to the drained URLs.
+func (c *Crawler) saveUnvisited() {
+	var urls []*URLContext
+
+	if c.draining {
+		seen := make(map[*URLContext]bool, len(c.drained))
+		urls = make([]*URLContext, 0, len(c.pending))
+		for _, ctx := range c.drained {
+			seen[ctx] = true
+			urls = append(urls, ctx)
+		}
+		for ctx := range c.pending {
+			if !seen[ctx] {
+				urls = append(urls, ctx)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.unvisited = urls
+	c.mu.Unlock()
+}
+
+// Indicates if the crawler is shutting down.
+func (w *worker) draining() bool {
+	select {
+	case <-w.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// Keep the URL in the queue instead of fetching it, so that it is handed
+// back to the crawler on shutdown. The robots.txt and the sitemaps are not
+// handed back.
+func (w *worker) keepOnDrain(ctx *URLContext) {
+	w.logFunc(LogInfo, "shutdown signal received, not fetching %s", ctx.url, urlAttr(ctx.url))
+	if !ctx.IsRobotsURL() && !ctx.sitemap {
+		w.queue.push(ctx)
+	}
+}
+
+// Hand the URLs waiting in the queue, on the pop channel and for a retry
+// back to the crawler.
+func (w *worker) drainURLs() {
+	var ctxs []*URLContext
+
+	select {
+	case batch := <-w.pop:
+		w.queue.push(batch...)
+	default:
+		// Nothing, just continue...
+	}
+	for w.queue.Len() > 0 {
+		if ctx := w.queue.pop(); !ctx.IsRobotsURL() {
+			ctxs = append(ctxs, ctx)
+		}
+	}
+	for _, r := range w.retries {
+		ctxs = append(ctxs, r.ctx)
+	}
+	w.retries = nil
+
+	w.logFunc(LogInfo, "shutdown signal received, draining %d URL(s).", len(ctxs))
+	if len(ctxs) == 0 {
+		return
+	}
+	select {
+	case w.push <- &workerResponse{host: w.host, drained: ctxs}:
+	case <-w.stop:
+		w.logFunc(LogInfo, "ignoring send response, will stop.")
+	}
+}
@@ -0,0 +1,158 @@
+package gocrawl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Start a server whose root page links to /a, /b, /c and /d, and whose /a
+// page blocks until released (or the request is aborted) and links to /e.
+func newShutdownServer(started chan<- struct{}, release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a> <a href="/d">d</a></body></html>`))
+		case "/a":
+			close(started)
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			w.Write([]byte(`<html><body><a href="/e">e</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body></body></html>`))
+		}
+	}))
+}
+
+func runShutdown(t *testing.T, ctx context.Context, release chan struct{}) (spy *spyExtender, urls []string, runErr, err error) {
+	started := make(chan struct{})
+	srv := newShutdownServer(started, release)
+	defer srv.Close()
+
+	spy = newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+	if _, err := c.Shutdown(ctx); err != ErrNotRunning {
+		t.Errorf("expected %v before Run, got %v", ErrNotRunning, err)
+	}
+
+	runDone := make(chan error)
+	go func() { runDone <- c.Run(srv.URL + "/") }()
+	<-started
+
+	relDone := make(chan struct{})
+	go func() {
+		defer close(relDone)
+		// Release the in-flight request once the shutdown is requested
+		time.Sleep(50 * time.Millisecond)
+		if err := c.Enqueue(srv.URL + "/f"); err != ErrNotRunning {
+			t.Errorf("expected %v on enqueue while shutting down, got %v", ErrNotRunning, err)
+		}
+		close(release)
+	}()
+	ctxs, err := c.Shutdown(ctx)
+	runErr = <-runDone
+	<-relDone
+
+	for _, ctx := range ctxs {
+		urls = append(urls, ctx.URL().Path)
+	}
+	sort.Strings(urls)
+	return spy, urls, runErr, err
+}
+
+func TestShutdown(t *testing.T) {
+	spy, urls, runErr, err := runShutdown(t, context.Background(), make(chan struct{}))
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if runErr != ErrShutdown {
+		t.Errorf("expected Run to return %v, got %v", ErrShutdown, runErr)
+	}
+	if got := strings.Join(urls, ","); got != "/b,/c,/d,/e" {
+		t.Errorf("expected unvisited URLs /b,/c,/d,/e, got %s", got)
+	}
+	// The in-flight URL is visited
+	assertCallCount(spy, "Shutdown", eMKVisit, 2, t)
+	assertCallCount(spy, "Shutdown", eMKVisited, 2, t)
+	assertIsInLog("Shutdown", spy.b, "shutting down, draining workers...\n", t)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	spy, urls, runErr, err := runShutdown(t, ctx, make(chan struct{}))
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if runErr != ErrInterrupted {
+		t.Errorf("expected Run to return %v, got %v", ErrInterrupted, runErr)
+	}
+	// The in-flight URL is aborted, so it is not visited
+	if got := strings.Join(urls, ","); got != "/a,/b,/c,/d" {
+		t.Errorf("expected unvisited URLs /a,/b,/c,/d, got %s", got)
+	}
+	assertCallCount(spy, "ShutdownTimeout", eMKVisit, 1, t)
+}
+
+func TestShutdownRateLimit(t *testing.T) {
+	visited := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/b">b</a></body></html>`))
+			close(visited)
+		default:
+			w.Write([]byte(`<html><body></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	spy := newSpy(new(DefaultExtender), true)
+	spy.setExtensionMethod(eMKRequestRobots, func(ctx *URLContext, agent string) ([]byte, bool) {
+		// No robots.txt request, so that the seed is fetched right away
+		return nil, false
+	})
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.MaxRequestsPerSecond = 0.1
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+
+	runDone := make(chan error)
+	go func() { runDone <- c.Run(srv.URL + "/") }()
+	<-visited
+	time.Sleep(50 * time.Millisecond)
+
+	// The worker waiting for the rate limit hands its URL back
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctxs, err := c.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := <-runDone; err != ErrShutdown {
+		t.Errorf("expected Run to return %v, got %v", ErrShutdown, err)
+	}
+	var urls []string
+	for _, ctx := range ctxs {
+		urls = append(urls, ctx.URL().Path)
+	}
+	sort.Strings(urls)
+	if got := strings.Join(urls, ","); got != "/a,/b" {
+		t.Errorf("expected unvisited URLs /a,/b, got %s", got)
+	}
+	assertCallCount(spy, "ShutdownRateLimit", eMKVisit, 1, t)
+}
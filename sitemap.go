@@ -0,0 +1,206 @@
+package gocrawl
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/purell"
+)
+
+const (
+	// Maximum uncompressed size of a sitemap, as per the sitemaps protocol.
+	sitemapMaxSize = 50 * 1024 * 1024
+
+	// Maximum nesting level of sitemap indexes. The protocol does not allow
+	// an index to reference other indexes, but be lenient.
+	sitemapMaxLevel = 2
+)
+
+// SitemapEntry contains the information about an URL listed in a sitemap.
+// The fields are the zero value if they are not specified in the sitemap.
+type SitemapEntry struct {
+	// Sitemap is the URL of the sitemap where the entry is listed.
+	Sitemap *url.URL
+
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+}
+
+// The XML structure of both the urlset and the sitemapindex documents.
+type xmlSitemap struct {
+	URLs []struct {
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		ChangeFreq string `xml:"changefreq"`
+		Priority   string `xml:"priority"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// The W3C datetime formats allowed for the lastmod value.
+var sitemapTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Parse a sitemap or sitemap index, possibly gzip-compressed, and return the
+// URLs and the sitemaps it lists.
+func parseSitemap(r io.Reader) (locs []string, entries []*SitemapEntry, sitemaps []string, err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var doc xmlSitemap
+	if err := xml.NewDecoder(io.LimitReader(r, sitemapMaxSize)).Decode(&doc); err != nil {
+		return nil, nil, nil, err
+	}
+	for _, u := range doc.URLs {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		e := &SitemapEntry{ChangeFreq: strings.TrimSpace(u.ChangeFreq)}
+		if lm := strings.TrimSpace(u.LastMod); lm != "" {
+			for _, f := range sitemapTimeFormats {
+				if t, err := time.Parse(f, lm); err == nil {
+					e.LastMod = t
+					break
+				}
+			}
+		}
+		if p, err := strconv.ParseFloat(strings.TrimSpace(u.Priority), 64); err == nil {
+			e.Priority = p
+		}
+		locs = append(locs, loc)
+		entries = append(entries, e)
+	}
+	for _, sm := range doc.Sitemaps {
+		if loc := strings.TrimSpace(sm.Loc); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return locs, entries, sitemaps, nil
+}
+
+// Fetch the sitemap at the specified location (relative to the parent URL),
+// and enqueue the URLs it lists. Sitemap indexes are followed up to
+// sitemapMaxLevel. The sitemaps of other hosts are enqueued, so that they
+// are fetched by the worker of their host, as per its robots.txt and crawl
+// delay.
+func (w *worker) requestSitemap(parent *URLContext, loc string, level int) {
+	u, err := parent.url.Parse(loc)
+	if err != nil {
+		w.reportError(newCrawlError(parent, err, CekParseURL))
+		w.logFunc(LogError, "ERROR parsing sitemap URL %s: %s", loc, err, slog.String("url", loc), errAttr(err))
+		return
+	}
+	nu := *u
+	purell.NormalizeURL(&nu, w.opts.URLNormalizationFlags)
+	ctx := &URLContext{
+		url:                 u,
+		normalizedURL:       &nu,
+		sourceURL:           parent.url,
+		normalizedSourceURL: parent.normalizedURL,
+		reqCtx:              parent.reqCtx,
+		sitemap:             true,
+		sitemapLevel:        level,
+	}
+	if sr, ok := extenderAs[SitemapRequester](w.opts.Extender); ok && !sr.RequestSitemap(ctx) {
+		w.stats.ignore("sitemap")
+		w.logFunc(LogIgnored, "ignore on sitemap policy: %s", u, urlAttr(u))
+		return
+	}
+
+	if nu.Host != w.host {
+		ctx.reqCtx = nil
+		w.logFunc(LogTrace, "sitemap %s of another host, enqueued", u, urlAttr(u))
+		select {
+		case w.enqueue <- ctx:
+		case <-w.stop:
+			w.logFunc(LogInfo, "stop signal received.")
+		}
+		return
+	}
+	w.fetchSitemap(ctx)
+}
+
+// Fetch the sitemap and enqueue the URLs it lists, then request the sitemaps
+// it lists, if it is a sitemap index.
+func (w *worker) fetchSitemap(ctx *URLContext) {
+	u, level := ctx.url, ctx.sitemapLevel
+	res, ok := w.fetchURL(ctx, w.opts.UserAgent, false)
+	if !ok {
+		if ctx.redirect != nil && level < sitemapMaxLevel {
+			w.requestSitemap(ctx, ctx.redirect.String(), level+1)
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		w.reportError(newCrawlErrorMessage(ctx, res.Status, CekHttpStatusCode))
+		w.logFunc(LogError, "ERROR status code for %s: %s", u, res.Status, urlAttr(u), statusAttr(res.StatusCode))
+		return
+	}
+	locs, entries, sitemaps, err := parseSitemap(res.Body)
+	if err != nil {
+		w.reportError(newCrawlError(ctx, err, CekParseSitemap))
+		w.logFunc(LogError, "ERROR parsing sitemap %s: %s", u, err, urlAttr(u), errAttr(err))
+		return
+	}
+	w.logFunc(LogInfo, "sitemap %s: %d URL(s), %d sitemap(s)", u, len(locs), len(sitemaps), urlAttr(u))
+
+	// Enqueue the URLs via the crawler, so that they go through the
+	// selection policies.
+	ctxs := make([]*URLContext, 0, len(locs))
+	for i, loc := range locs {
+		lu, err := u.Parse(loc)
+		if err != nil {
+			w.stats.ignore("unparsable")
+			w.logFunc(LogIgnored, "ignore on unparsable policy %s: %s", loc, err, slog.String("url", loc), errAttr(err))
+			continue
+		}
+		entries[i].Sitemap = u
+		lctx := newURLContext(lu, u, w.opts)
+		lctx.sitemapEntry = entries[i]
+		ctxs = append(ctxs, lctx)
+	}
+	if len(ctxs) > 0 {
+		select {
+		case w.enqueue <- ctxs:
+		case <-w.stop:
+			w.logFunc(LogInfo, "stop signal received.")
+			return
+		}
+	}
+
+	if level < sitemapMaxLevel {
+		for _, sm := range sitemaps {
+			w.requestSitemap(ctx, sm, level+1)
+		}
+	} else if len(sitemaps) > 0 {
+		w.stats.ignore("sitemap-level")
+		w.logFunc(LogIgnored, "ignore on sitemap index level policy: %d sitemap(s) in %s", len(sitemaps), u, urlAttr(u))
+	}
+}
@@ -0,0 +1,77 @@
+package gocrawl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc> http://example.com/a </loc>
+    <lastmod>2021-03-04</lastmod>
+    <changefreq>daily</changefreq>
+    <priority>0.8</priority>
+  </url>
+  <url>
+    <loc>http://example.com/b</loc>
+    <lastmod>2021-03-04T10:20:30+01:00</lastmod>
+  </url>
+  <url>
+    <loc></loc>
+  </url>
+</urlset>`
+
+const testSitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>http://example.com/s1.xml</loc></sitemap>
+  <sitemap><loc>http://example.com/s2.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func TestParseSitemap(t *testing.T) {
+	locs, entries, sitemaps, err := parseSitemap(strings.NewReader(testURLSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 2 || locs[0] != "http://example.com/a" || locs[1] != "http://example.com/b" {
+		t.Fatalf("unexpected locs: %v", locs)
+	}
+	if len(sitemaps) != 0 {
+		t.Errorf("expected no sitemap, got %v", sitemaps)
+	}
+	if e := entries[0]; e.ChangeFreq != "daily" || e.Priority != 0.8 ||
+		!e.LastMod.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected first entry: %+v", e)
+	}
+	if e := entries[1]; e.Priority != 0 ||
+		!e.LastMod.Equal(time.Date(2021, 3, 4, 9, 20, 30, 0, time.UTC)) {
+		t.Errorf("unexpected second entry: %+v", e)
+	}
+}
+
+func TestParseSitemapIndexGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(testSitemapIndex))
+	gz.Close()
+
+	locs, _, sitemaps, err := parseSitemap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 0 {
+		t.Errorf("expected no loc, got %v", locs)
+	}
+	if len(sitemaps) != 2 || sitemaps[1] != "http://example.com/s2.xml.gz" {
+		t.Errorf("unexpected sitemaps: %v", sitemaps)
+	}
+}
+
+func TestParseSitemapInvalid(t *testing.T) {
+	if _, _, _, err := parseSitemap(strings.NewReader("not xml <")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -66,9 +66,9 @@ type spyExtender struct {
 	methods      map[extensionMethodKey]interface{}
 	calledWith   map[extensionMethodKey][][]interface{}
 	b            bytes.Buffer
-	m            sync.RWMutex       // Protects access to call count, methods and called with maps
-	logM         sync.Mutex         // Protects access to the log buffer (b)
-	EnqueueChan  chan<- interface{} // Redefine here, not accessible on DefaultExtender
+	m            sync.RWMutex // Protects access to call count, methods and called with maps
+	logM         sync.Mutex   // Protects access to the log buffer (b)
+	Enqueuer     Enqueuer     // Redefine here, not accessible on DefaultExtender
 }
 
 func newSpy(ext Extender, useLogBuffer bool) *spyExtender {
@@ -138,6 +138,13 @@ func isCalledWith(actual, compare []interface{}) bool {
 	return true
 }
 
+func (x *spyExtender) SetEnqueuer(e Enqueuer) {
+	x.Enqueuer = e
+	if es, ok := x.Extender.(EnqueuerSetter); ok {
+		es.SetEnqueuer(e)
+	}
+}
+
 func (x *spyExtender) Log(logFlags LogFlags, msgLevel LogFlags, msg string) {
 	if x.useLogBuffer {
 		if logFlags&msgLevel == msgLevel {
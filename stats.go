@@ -0,0 +1,209 @@
+package gocrawl
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the statistics of a crawl, see Crawler.Stats.
+type Stats struct {
+	// Start is the time when Run was called, and End the time when it
+	// returned, or zero if the crawl is still running.
+	Start time.Time
+	End   time.Time
+
+	// Enqueued is the number of URLs stacked on the workers, Visited the
+	// number of URLs visited.
+	Enqueued int
+	Visited  int
+
+	// Ignored is the number of URLs ignored by reason, e.g. "filter",
+	// "robots" or "rule:<name>" (see the README for the list of reasons).
+	Ignored map[string]int
+
+	// Errors is the number of errors by kind.
+	Errors map[CrawlErrorKind]int
+
+	// BytesFetched is the number of bytes of the response bodies read by
+	// the crawler, including those of the robots.txt and sitemaps.
+	BytesFetched int64
+
+	// ActiveWorkers is the number of running workers, that is the number
+	// of hosts being crawled.
+	ActiveWorkers int
+
+	// Hosts are the statistics by host.
+	Hosts map[string]HostStats
+}
+
+// HostStats holds the statistics of a host in a Stats snapshot.
+type HostStats struct {
+	// Queued is the number of URLs stacked on the host's worker that are
+	// not processed yet, including the URL being processed and those
+	// waiting to be retried.
+	Queued int
+
+	// Visited is the number of URLs visited.
+	Visited int
+
+	// CrawlDelay is the last crawl delay computed for the host.
+	CrawlDelay time.Duration
+}
+
+// The statistics of a crawl, updated by the crawler and the workers. The
+// methods are no-ops on a nil value.
+type crawlStats struct {
+	mu sync.Mutex
+	s  Stats
+}
+
+func newCrawlStats() *crawlStats {
+	return &crawlStats{
+		s: Stats{
+			Start:   time.Now(),
+			Ignored: make(map[string]int),
+			Errors:  make(map[CrawlErrorKind]int),
+			Hosts:   make(map[string]HostStats),
+		},
+	}
+}
+
+// Return a copy of the statistics.
+func (cs *crawlStats) snapshot() *Stats {
+	if cs == nil {
+		return &Stats{}
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	s := cs.s
+	s.Ignored = make(map[string]int, len(cs.s.Ignored))
+	for k, v := range cs.s.Ignored {
+		s.Ignored[k] = v
+	}
+	s.Errors = make(map[CrawlErrorKind]int, len(cs.s.Errors))
+	for k, v := range cs.s.Errors {
+		s.Errors[k] = v
+	}
+	s.Hosts = make(map[string]HostStats, len(cs.s.Hosts))
+	for k, v := range cs.s.Hosts {
+		s.Hosts[k] = v
+	}
+	return &s
+}
+
+// Update the statistics under the lock.
+func (cs *crawlStats) update(fn func(s *Stats)) {
+	if cs == nil {
+		return
+	}
+	cs.mu.Lock()
+	fn(&cs.s)
+	cs.mu.Unlock()
+}
+
+// Update the statistics of the host under the lock.
+func (cs *crawlStats) updateHost(host string, fn func(hs *HostStats)) {
+	cs.update(func(s *Stats) {
+		hs := s.Hosts[host]
+		fn(&hs)
+		s.Hosts[host] = hs
+	})
+}
+
+func (cs *crawlStats) ignore(reason string) {
+	cs.update(func(s *Stats) { s.Ignored[reason]++ })
+}
+
+func (cs *crawlStats) error(kind CrawlErrorKind) {
+	cs.update(func(s *Stats) { s.Errors[kind]++ })
+}
+
+func (cs *crawlStats) addBytes(n int) {
+	cs.update(func(s *Stats) { s.BytesFetched += int64(n) })
+}
+
+func (cs *crawlStats) enqueue(host string) {
+	cs.update(func(s *Stats) {
+		s.Enqueued++
+		hs := s.Hosts[host]
+		hs.Queued++
+		s.Hosts[host] = hs
+	})
+}
+
+func (cs *crawlStats) done(host string, visited bool) {
+	cs.update(func(s *Stats) {
+		hs := s.Hosts[host]
+		hs.Queued--
+		if visited {
+			s.Visited++
+			hs.Visited++
+		}
+		s.Hosts[host] = hs
+	})
+}
+
+// A response body that counts the bytes read in the statistics.
+type countingBody struct {
+	io.ReadCloser
+	stats *crawlStats
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.stats.addBytes(n)
+	}
+	return n, err
+}
+
+// Stats returns a snapshot of the statistics of the crawl. It is safe to
+// call concurrently while the crawler is running. Once Run returns, it is
+// the summary of the whole crawl, with the End time set, until the next
+// call to Run.
+func (c *Crawler) Stats() *Stats {
+	c.mu.Lock()
+	cs := c.stats
+	c.mu.Unlock()
+	return cs.snapshot()
+}
+
+// Report the error to the Extender, and count it in the statistics.
+func (c *Crawler) reportError(err *CrawlError) {
+	c.stats.error(err.Kind)
+	c.Options.Extender.Error(err)
+}
+
+// Report the error to the Extender, and count it in the statistics.
+func (w *worker) reportError(err *CrawlError) {
+	w.stats.error(err.Kind)
+	w.opts.Extender.Error(err)
+}
+
+// Mark the end of the crawl in the statistics, and log the summary.
+func (c *Crawler) endStats() {
+	c.stats.update(func(s *Stats) {
+		s.End = time.Now()
+		s.ActiveWorkers = 0
+	})
+	c.logStats(c.stats.snapshot())
+}
+
+// Log the summary of the crawl statistics.
+func (c *Crawler) logStats(s *Stats) {
+	var ignored, errors int
+	for _, n := range s.Ignored {
+		ignored += n
+	}
+	for _, n := range s.Errors {
+		errors += n
+	}
+	d := s.End.Sub(s.Start)
+	c.logFunc(LogInfo, "crawl summary - visited: %d, enqueued: %d, ignored: %d, errors: %d, bytes: %d, duration: %v",
+		s.Visited, s.Enqueued, ignored, errors, s.BytesFetched, d,
+		slog.Int("visited", s.Visited), slog.Int("enqueued", s.Enqueued), slog.Int("ignored", ignored),
+		slog.Int("errors", errors), slog.Int64("bytes", s.BytesFetched), durationAttr(d))
+}
@@ -0,0 +1,148 @@
+package gocrawl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type statsExtender struct {
+	*spyExtender
+	c       *Crawler
+	running *Stats
+}
+
+func (x *statsExtender) Visit(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+	if ctx.URL().Path == "/a" {
+		x.running = x.c.Stats()
+	}
+	return x.spyExtender.Visit(ctx, res, doc)
+}
+
+func TestStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/private">p</a> <a href="/missing">m</a> <a href="http://other.host/">o</a></body></html>`))
+		case "/a":
+			w.Write([]byte(`<html><body><a href="/">home</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	x := &statsExtender{spyExtender: newSpy(new(DefaultExtender), true)}
+	opts := NewOptions(x)
+	opts.CrawlDelay = 0
+	opts.LogFlags = LogAll
+	c := NewCrawlerWithOptions(opts)
+	x.c = c
+	if s := c.Stats(); s.Visited != 0 || !s.Start.IsZero() {
+		t.Errorf("expected empty stats before Run, got %+v", s)
+	}
+	c.Run(srv.URL + "/")
+
+	if x.running == nil || !x.running.End.IsZero() || x.running.ActiveWorkers != 1 || x.running.Hosts[u.Host].Queued == 0 {
+		t.Errorf("unexpected running stats %+v", x.running)
+	}
+
+	s := c.Stats()
+	if s.Start.IsZero() || s.End.Before(s.Start) {
+		t.Errorf("expected start and end times, got %v, %v", s.Start, s.End)
+	}
+	if s.Visited != 2 || s.Enqueued != 4 || s.ActiveWorkers != 0 {
+		t.Errorf("expected 2 visited, 4 enqueued and no worker, got %d, %d, %d", s.Visited, s.Enqueued, s.ActiveWorkers)
+	}
+	wantIgnored := map[string]int{"robots": 1, "same-host": 1, "filter": 1}
+	if len(s.Ignored) != len(wantIgnored) {
+		t.Errorf("expected ignored %v, got %v", wantIgnored, s.Ignored)
+	}
+	for k, v := range wantIgnored {
+		if s.Ignored[k] != v {
+			t.Errorf("expected %d ignored on %s, got %d", v, k, s.Ignored[k])
+		}
+	}
+	if len(s.Errors) != 1 || s.Errors[CekHttpStatusCode] != 1 {
+		t.Errorf("expected 1 status code error, got %v", s.Errors)
+	}
+	if s.BytesFetched == 0 {
+		t.Error("expected bytes fetched")
+	}
+	if hs := s.Hosts[u.Host]; hs.Queued != 0 || hs.Visited != 2 || hs.CrawlDelay != 0 {
+		t.Errorf("unexpected host stats %+v", hs)
+	}
+	assertIsInLog("Stats", x.b, "crawl summary - visited: 2, enqueued: 4, ignored: 3, errors: 1, bytes: ", t)
+
+	// The snapshot is a copy
+	s.Ignored["robots"] = 10
+	if c.Stats().Ignored["robots"] != 1 {
+		t.Error("expected the stats to be unchanged")
+	}
+}
+
+func TestStatsMaxVisits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body></body></html>`))
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.CrawlDelay = 0
+	opts.MaxVisits = 2
+	c := NewCrawlerWithOptions(opts)
+	if err := c.Run(srv.URL + "/"); err != ErrMaxVisits {
+		t.Fatalf("expected ErrMaxVisits, got %v", err)
+	}
+	assertCallCount(spy, "StatsMaxVisits", eMKVisit, 2, t)
+
+	// The visit that reaches MaxVisits is counted
+	s := c.Stats()
+	if s.Visited != 2 || s.Enqueued != 4 {
+		t.Errorf("expected 2 visited and 4 enqueued, got %d, %d", s.Visited, s.Enqueued)
+	}
+	if hs := s.Hosts[u.Host]; hs.Queued != 2 || hs.Visited != 2 {
+		t.Errorf("unexpected host stats %+v", hs)
+	}
+}
+
+// A Store that fails to load the Frontier.
+type failingStore struct{}
+
+func (failingStore) Load() (*Frontier, error) { return nil, errors.New("corrupt checkpoint") }
+func (failingStore) Save(*Frontier) error     { return nil }
+
+func TestStatsRestoreError(t *testing.T) {
+	spy := newSpy(new(DefaultExtender), true)
+	opts := NewOptions(spy)
+	opts.Store = failingStore{}
+	c := NewCrawlerWithOptions(opts)
+	if err := c.Run("http://localhost/"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The summary is complete even if the crawl could not start
+	s := c.Stats()
+	if s.Start.IsZero() || s.End.Before(s.Start) {
+		t.Errorf("expected start and end times, got %v, %v", s.Start, s.End)
+	}
+	if s.Errors[CekStore] != 1 {
+		t.Errorf("expected 1 store error, got %v", s.Errors)
+	}
+}
@@ -0,0 +1,224 @@
+package gocrawl
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Frontier is a snapshot of the state of a crawl: the normalized URLs that
+// have been visited (or are committed to be visited), the URLs that are
+// still waiting in the workers' queues, and the URLs scheduled for a revisit
+// (see Options.RevisitPolicy).
+type Frontier struct {
+	Visited   []string
+	Pending   []*PendingURL
+	Scheduled []*PendingURL
+}
+
+// PendingURL is the persistable form of an URLContext that is waiting to be
+// processed by a worker. The State must be a type that can be encoded by the
+// Store implementation (for the FileStore, non-builtin types must be
+// registered using gob.Register).
+type PendingURL struct {
+	URL           string
+	SourceURL     string
+	HeadBeforeGet bool
+	Priority      int
+	Depth         int
+	State         interface{}
+
+	// NextVisit is the time of the next visit of a scheduled URL.
+	NextVisit time.Time
+}
+
+// Store is the interface required to persist the crawl frontier and visited
+// set so that a crawl can be resumed. Load is called once when the crawl
+// starts, and should return a nil Frontier if there is nothing to resume.
+// Save is called periodically (see Options.CheckpointInterval) and when the
+// crawl ends.
+type Store interface {
+	Load() (*Frontier, error)
+	Save(*Frontier) error
+}
+
+// FileStore is a Store implementation that saves the Frontier in a single
+// file, using the encoding/gob package.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore that saves the Frontier to the file at the
+// specified path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path}
+}
+
+// Load reads the Frontier from the file. It returns a nil Frontier if the
+// file does not exist.
+func (fs *FileStore) Load() (*Frontier, error) {
+	var fr Frontier
+	if err := readGobFile(fs.path, &fr); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &fr, nil
+}
+
+// Save writes the Frontier to the file, replacing the previous checkpoint
+// only once the new one is complete.
+func (fs *FileStore) Save(fr *Frontier) error {
+	return writeGobFile(fs.path, fr)
+}
+
+// Decode the value from the file at the path, using encoding/gob.
+func readGobFile(path string, v interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewDecoder(f).Decode(v)
+}
+
+// Encode the value to the file at the path, using encoding/gob. It writes to
+// a temporary file in the same directory and renames it, so that the file is
+// never read half-written.
+func writeGobFile(path string, v interface{}) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(v)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Return the path of the file of the key in the directory, named after the
+// SHA-1 hash of the key, with the extension.
+func hashedPath(dir, key, ext string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+ext)
+}
+
+// Build the Frontier snapshot from the visited map and the pending URLs.
+func (c *Crawler) frontier() *Frontier {
+	fr := &Frontier{
+		Visited: make([]string, 0, len(c.visited)),
+		Pending: make([]*PendingURL, 0, len(c.pending)),
+	}
+	for u := range c.visited {
+		fr.Visited = append(fr.Visited, u)
+	}
+	for ctx := range c.pending {
+		fr.Pending = append(fr.Pending, newPendingURL(ctx))
+	}
+	for _, vs := range c.revisits.items {
+		p := newPendingURL(vs.ctx)
+		p.NextVisit = vs.next
+		fr.Scheduled = append(fr.Scheduled, p)
+	}
+	return fr
+}
+
+func newPendingURL(ctx *URLContext) *PendingURL {
+	p := &PendingURL{
+		URL:           ctx.url.String(),
+		HeadBeforeGet: ctx.HeadBeforeGet,
+		Priority:      ctx.Priority,
+		Depth:         ctx.depth,
+		State:         ctx.State,
+	}
+	if ctx.sourceURL != nil {
+		p.SourceURL = ctx.sourceURL.String()
+	}
+	return p
+}
+
+// Save the current Frontier to the Store, if one is set.
+func (c *Crawler) checkpoint() {
+	if c.Options.Store == nil {
+		return
+	}
+	fr := c.frontier()
+	if err := c.Options.Store.Save(fr); err != nil {
+		c.reportError(newCrawlError(nil, err, CekStore))
+		c.logFunc(LogError, "ERROR saving checkpoint: %s", err, errAttr(err))
+		return
+	}
+	c.logFunc(LogTrace, "checkpoint saved - visited: %d, pending: %d", len(fr.Visited), len(fr.Pending))
+}
+
+// Restore the visited map, the pending URLs and the scheduled URLs from the
+// Store, if one is set. The pending URLs are stacked directly on their
+// worker, since they already went through the selection policies before
+// being saved. The visit history of the scheduled URLs is not saved, so the
+// RevisitPolicy starts anew after their next visit.
+func (c *Crawler) restore() error {
+	if c.Options.Store == nil {
+		return nil
+	}
+	fr, err := c.Options.Store.Load()
+	if err != nil || fr == nil {
+		return err
+	}
+	c.logFunc(LogInfo, "resuming crawl - visited: %d, pending: %d, scheduled: %d", len(fr.Visited), len(fr.Pending), len(fr.Scheduled))
+
+	for _, u := range fr.Visited {
+		c.visited[u] = nil
+	}
+	for _, p := range fr.Pending {
+		if ctx := c.pendingToURLContext(p); ctx != nil {
+			c.stackURL(ctx)
+		}
+	}
+	for _, p := range fr.Scheduled {
+		if ctx := c.pendingToURLContext(p); ctx != nil {
+			vs := &visitSchedule{ctx: ctx, next: p.NextVisit, index: -1}
+			c.visited[ctx.normalizedURL.String()] = vs
+			c.revisits.schedule(vs)
+		}
+	}
+	return nil
+}
+
+// Convert the saved URL to an URLContext, or nil if it cannot be parsed.
+func (c *Crawler) pendingToURLContext(p *PendingURL) *URLContext {
+	var src *url.URL
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		c.reportError(newCrawlError(nil, err, CekParseURL))
+		c.logFunc(LogError, "ERROR parsing URL %s", p.URL, slog.String("url", p.URL), errAttr(err))
+		return nil
+	}
+	if p.SourceURL != "" {
+		if src, err = url.Parse(p.SourceURL); err != nil {
+			c.reportError(newCrawlError(nil, err, CekParseURL))
+			c.logFunc(LogError, "ERROR parsing URL %s", p.SourceURL, slog.String("url", p.SourceURL), errAttr(err))
+			return nil
+		}
+	}
+	ctx := c.urlToURLContext(u, src)
+	ctx.HeadBeforeGet = p.HeadBeforeGet
+	ctx.Priority = p.Priority
+	ctx.depth = p.Depth
+	ctx.State = p.State
+	return ctx
+}
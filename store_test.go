@@ -0,0 +1,47 @@
+package gocrawl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewFileStore(filepath.Join(dir, "frontier"))
+	fr, err := fs.Load()
+	if err != nil {
+		t.Fatalf("load of missing file failed with %v", err)
+	}
+	if fr != nil {
+		t.Fatalf("want nil frontier for missing file, got %v", fr)
+	}
+
+	want := &Frontier{
+		Visited: []string{"http://hosta/page1.html", "http://hosta/page2.html"},
+		Pending: []*PendingURL{
+			{URL: "http://hosta/page2.html", SourceURL: "http://hosta/page1.html", HeadBeforeGet: true, State: "st"},
+		},
+		Scheduled: []*PendingURL{
+			{URL: "http://hosta/page1.html", NextVisit: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+	if err := fs.Save(want); err != nil {
+		t.Fatalf("save failed with %v", err)
+	}
+	got, err := fs.Load()
+	if err != nil {
+		t.Fatalf("load failed with %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
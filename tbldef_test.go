@@ -353,6 +353,55 @@ var (
 			},
 		},
 
+		&testCase{
+			name: "ScopeSubdomains",
+			opts: &Options{
+				Scope:                 ScopeSubdomains,
+				CrawlDelay:            DefaultTestCrawlDelay,
+				LogFlags:              LogAll,
+				URLNormalizationFlags: DefaultNormalizationFlags,
+			},
+			seeds: []string{
+				"http://hosta/page1.html",
+			},
+			funcs: f{
+				eMKVisit: func(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+					if ctx.URL().Host == "hosta" {
+						return []string{"http://www.hosta/page2.html", "http://hostb/page1.html"}, false
+					}
+					return nil, false
+				},
+			},
+			asserts: a{
+				eMKFilter: 3, // hosta/page1, www.hosta/page2, hostb/page1
+				eMKVisit:  2, // hosta/page1, www.hosta/page2
+			},
+			logAsserts: []string{
+				"ignore on scope policy (subdomains): http://hostb/page1.html",
+			},
+		},
+
+		&testCase{
+			name: "ExcludeRules",
+			opts: &Options{
+				SameHostOnly:          true,
+				ExcludeRules:          []*URLRule{{Name: "page3", Glob: "/page3.html"}},
+				CrawlDelay:            DefaultTestCrawlDelay,
+				LogFlags:              LogAll,
+				URLNormalizationFlags: DefaultNormalizationFlags,
+			},
+			seeds: []string{
+				"http://hosta/page1.html",
+			},
+			asserts: a{
+				eMKFilter: 5, // hosta/page1 x2, hosta/page2, hostb/page1 x2
+				eMKVisit:  2, // hosta/page1, hosta/page2
+			},
+			logAsserts: []string{
+				"ignore on rule page3: http://hosta/page3.html",
+			},
+		},
+
 		&testCase{
 			name: "ReadBodyInVisitor",
 			opts: &Options{
@@ -554,7 +603,7 @@ var (
 		},
 
 		&testCase{
-			name: "EnqueueChanDefault",
+			name: "EnqueuerDefault",
 			opts: &Options{
 				SameHostOnly: true,
 				CrawlDelay:   DefaultTestCrawlDelay,
@@ -562,7 +611,9 @@ var (
 			},
 			seeds: "",
 			customAssert: func(spy *spyExtender, t *testing.T) {
-				assertTrue(spy.EnqueueChan != nil, "expected EnqueueChan to be non-nil")
+				assertTrue(spy.Enqueuer != nil, "expected Enqueuer to be non-nil")
+				ext := spy.Extender.(*fileFetcherExtender)
+				assertTrue(ext.Enqueuer != nil, "expected wrapped Enqueuer to be non-nil")
 			},
 		},
 
@@ -1093,6 +1144,35 @@ var (
 			},
 		},
 
+		&testCase{
+			name: "MaxDepth",
+			opts: &Options{
+				SameHostOnly: true,
+				CrawlDelay:   DefaultTestCrawlDelay,
+				MaxDepth:     1,
+				LogFlags:     LogAll,
+			},
+			seeds: []string{
+				"http://hostb/pageunlinked.html",
+			},
+			funcs: f{
+				eMKVisit: func(ctx *URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+					want := 0
+					if ctx.normalizedURL.Path == "/page1.html" {
+						want = 1
+					}
+					assertTrue(ctx.Depth() == want, "expected depth %d for %s, got %d", want, ctx.normalizedURL, ctx.Depth())
+					return nil, true
+				},
+			},
+			asserts: a{
+				eMKVisit: 2, // pageunlinked (depth 0), page1 (depth 1)
+			},
+			logAsserts: []string{
+				"ignore on depth policy: http://hostb/page2.html\n",
+			},
+		},
+
 		&testCase{
 			name:     "NoCrawlDelay",
 			external: testNoCrawlDelay,
@@ -1119,13 +1199,18 @@ var (
 		},
 
 		&testCase{
-			name:     "EnqueueChanEmbedded",
-			external: testEnqueueChanEmbedded,
+			name:     "EnqueuerEmbedded",
+			external: testEnqueuerEmbedded,
 		},
 
 		&testCase{
-			name:     "EnqueueChanShadowed",
-			external: testEnqueueChanShadowed,
+			name:     "EnqueueNotRunning",
+			external: testEnqueueNotRunning,
+		},
+
+		&testCase{
+			name:     "EnqueueClosed",
+			external: testEnqueueClosed,
 		},
 
 		&testCase{
@@ -1137,5 +1222,95 @@ var (
 			name:     "EnqueueNewUrlOnError",
 			external: testEnqueueNewURLOnError,
 		},
+
+		&testCase{
+			name:     "ResumeFromStore",
+			external: testResumeFromStore,
+		},
+
+		&testCase{
+			name:     "RunContextDeadline",
+			external: testRunContextDeadline,
+		},
+
+		&testCase{
+			name:     "Priority",
+			external: testPriority,
+		},
+
+		&testCase{
+			name:     "RetryStatusCode",
+			external: testRetryStatusCode,
+		},
+
+		&testCase{
+			name:     "RetryGiveUp",
+			external: testRetryGiveUp,
+		},
+
+		&testCase{
+			name:     "RetrierExtender",
+			external: testRetrierExtender,
+		},
+
+		&testCase{
+			name:     "RetrierThrottleDeclined",
+			external: testRetrierThrottleDeclined,
+		},
+
+		&testCase{
+			name:     "RetryAfterThrottle",
+			external: testRetryAfterThrottle,
+		},
+
+		&testCase{
+			name:     "MaxConcurrentHosts",
+			external: testMaxConcurrentHosts,
+		},
+
+		&testCase{
+			name:     "FetchSitemaps",
+			external: testFetchSitemaps,
+		},
+
+		&testCase{
+			name:     "SitemapRequester",
+			external: testSitemapRequester,
+		},
+
+		&testCase{
+			name:     "CrossHostSitemap",
+			external: testCrossHostSitemap,
+		},
+
+		&testCase{
+			name:     "RobotsServerError",
+			external: testRobotsServerError,
+		},
+
+		&testCase{
+			name:     "RobotsUnreachable",
+			external: testRobotsUnreachable,
+		},
+
+		&testCase{
+			name:     "RobotsRedirects",
+			external: testRobotsRedirects,
+		},
+
+		&testCase{
+			name:     "RobotsClientError",
+			external: testRobotsClientError,
+		},
+
+		&testCase{
+			name:     "RobotsExpiry",
+			external: testRobotsExpiry,
+		},
+
+		&testCase{
+			name:     "RobotsMaxSize",
+			external: testRobotsMaxSize,
+		},
 	}
 )
@@ -2,6 +2,8 @@ package gocrawl
 
 import (
 	"bytes"
+	"context"
+	"log/slog"
 	"net/url"
 	"strings"
 
@@ -25,11 +27,40 @@ type URLContext struct {
 	HeadBeforeGet bool
 	State         interface{}
 
+	// Priority orders the URLs waiting to be processed by a host's worker,
+	// URLs with a higher priority are fetched first. It is zero by default,
+	// and can be set in the Filter or Enqueued extender methods.
+	Priority int
+
 	// Internal fields, available through getters
 	url                 *url.URL
 	normalizedURL       *url.URL
 	sourceURL           *url.URL
 	normalizedSourceURL *url.URL
+	depth               int
+	attempts            int
+	reqCtx              context.Context
+	link                *Link
+	robots              RobotsDirectives
+	sitemap             bool
+	sitemapLevel        int
+	sitemapEntry        *SitemapEntry
+	redirect            *url.URL
+	contentHash         []byte
+	notModified         bool
+	unconditional       bool
+	canonicalURL        *url.URL
+}
+
+// Context returns the context of the URL's processing. It is cancelled when
+// the crawler stops (see Crawler.RunContext) or when the worker is done with
+// the URL, and should be used to make the requests in Extender.Fetch. It
+// returns context.Background if the URL is not being processed by a worker.
+func (uc *URLContext) Context() context.Context {
+	if uc.reqCtx == nil {
+		return context.Background()
+	}
+	return uc.reqCtx
 }
 
 // URL returns the URL.
@@ -55,6 +86,47 @@ func (uc *URLContext) NormalizedSourceURL() *url.URL {
 	return uc.normalizedSourceURL
 }
 
+// Depth returns the link depth of the URL, that is the number of links
+// followed from a seed to reach it. Seeds and URLs enqueued via
+// Crawler.Enqueue have a depth of 0, and redirections keep the depth of the
+// redirecting URL.
+func (uc *URLContext) Depth() int {
+	return uc.depth
+}
+
+// Link returns the link that was followed to reach this URL, with the element
+// and attribute where it was found. It is nil if the URL was not harvested by
+// a LinkExtractor (e.g. for seeds).
+func (uc *URLContext) Link() *Link {
+	return uc.link
+}
+
+// RobotsDirectives returns the page-level robots directives of the URL, from
+// the robots meta tags and the X-Robots-Tag headers. They are set when the
+// URL is visited, before the call to Extender.Visit.
+func (uc *URLContext) RobotsDirectives() RobotsDirectives {
+	return uc.robots
+}
+
+// CanonicalURL returns the normalized canonical URL declared by the page,
+// in a Link header or a link tag with rel="canonical", or nil if it does
+// not declare one. It is set when the URL is visited, before the call to
+// Extender.Visit. See Options.CanonicalIdentity.
+func (uc *URLContext) CanonicalURL() *url.URL {
+	return uc.canonicalURL
+}
+
+// Sitemap returns the sitemap entry that listed this URL, or nil if the URL
+// was not discovered in a sitemap (see Options.FetchSitemaps).
+func (uc *URLContext) Sitemap() *SitemapEntry {
+	return uc.sitemapEntry
+}
+
+// IsSitemapURL indicates if the URL is a sitemap URL.
+func (uc *URLContext) IsSitemapURL() bool {
+	return uc.sitemap
+}
+
 // IsRobotsURL indicates if the URL is a robots.txt URL.
 func (uc *URLContext) IsRobotsURL() bool {
 	return isRobotsURL(uc.normalizedURL)
@@ -90,10 +162,29 @@ func (uc *URLContext) cloneForRedirect(dst *url.URL, normFlags purell.Normalizat
 	return &URLContext{
 		HeadBeforeGet:       uc.HeadBeforeGet,
 		State:               uc.State,
+		Priority:            uc.Priority,
 		url:                 rawDst,
 		normalizedURL:       dst,
 		sourceURL:           src,
 		normalizedSourceURL: normalizedSrc,
+		depth:               uc.depth,
+	}
+}
+
+// cloneForRevisit returns a new URLContext for the same URL, to visit it
+// again.
+func (uc *URLContext) cloneForRevisit() *URLContext {
+	return &URLContext{
+		HeadBeforeGet:       uc.HeadBeforeGet,
+		State:               uc.State,
+		Priority:            uc.Priority,
+		url:                 uc.url,
+		normalizedURL:       uc.normalizedURL,
+		sourceURL:           uc.sourceURL,
+		normalizedSourceURL: uc.normalizedSourceURL,
+		depth:               uc.depth,
+		link:                uc.link,
+		sitemapEntry:        uc.sitemapEntry,
 	}
 }
 
@@ -127,25 +218,35 @@ func (uc *URLContext) getRobotsURLCtx() (*URLContext, error) {
 		return nil, err
 	}
 	return &URLContext{
-		false, // Never request HEAD before GET for robots.txt
-		nil,   // Always nil state
-		robURL,
-		robURL,       // Normalized is same as raw
-		uc.sourceURL, // Source and normalized source is same as for current context
-		uc.normalizedSourceURL,
+		HeadBeforeGet:       false, // Never request HEAD before GET for robots.txt
+		State:               nil,   // Always nil state
+		url:                 robURL,
+		normalizedURL:       robURL,       // Normalized is same as raw
+		sourceURL:           uc.sourceURL, // Source and normalized source is same as for current context
+		normalizedSourceURL: uc.normalizedSourceURL,
+		depth:               uc.depth,
 	}, nil
 }
 
-func (c *Crawler) toURLContexts(raw interface{}, src *url.URL) []*URLContext {
-	var res []*URLContext
+// Convert the raw URL data to URLContexts. The parent is the URLContext of the
+// page where the URLs were harvested, or nil for seeds and enqueued URLs.
+func (c *Crawler) toURLContexts(raw interface{}, parent *URLContext) []*URLContext {
+	var res, kept []*URLContext
+	var src *url.URL
+	var depth int
+
+	if parent != nil {
+		src = parent.url
+		depth = parent.depth + 1
+	}
 
 	mapString := func(v S) {
 		res = make([]*URLContext, 0, len(v))
 		for s, st := range v {
 			ctx, err := c.stringToURLContext(s, src)
 			if err != nil {
-				c.Options.Extender.Error(newCrawlError(nil, err, CekParseURL))
-				c.logFunc(LogError, "ERROR parsing URL %s", s)
+				c.reportError(newCrawlError(nil, err, CekParseURL))
+				c.logFunc(LogError, "ERROR parsing URL %s", s, slog.String("url", s), errAttr(err))
 			} else {
 				ctx.State = st
 				res = append(res, ctx)
@@ -162,16 +263,36 @@ func (c *Crawler) toURLContexts(raw interface{}, src *url.URL) []*URLContext {
 		}
 	}
 
+	// Contexts harvested from a page are created anew from their URL, unless
+	// they were created for a sitemap or for the URLs it lists. Other contexts
+	// (e.g. redirections) keep their depth and source.
+	mapContexts := func(v []*URLContext) {
+		res = make([]*URLContext, 0, len(v))
+		for _, ctx := range v {
+			if parent == nil || ctx.sitemap || ctx.sitemapEntry != nil {
+				kept = append(kept, ctx)
+				continue
+			}
+			u := *ctx.url
+			nctx := c.urlToURLContext(&u, src)
+			nctx.HeadBeforeGet, nctx.State, nctx.Priority = ctx.HeadBeforeGet, ctx.State, ctx.Priority
+			res = append(res, nctx)
+		}
+	}
+
 	switch v := raw.(type) {
 	case *URLContext:
-		res = []*URLContext{v}
+		mapContexts([]*URLContext{v})
+
+	case []*URLContext:
+		mapContexts(v)
 
 	case string:
 		// Convert a single string URL to an URLContext
 		ctx, err := c.stringToURLContext(v, src)
 		if err != nil {
-			c.Options.Extender.Error(newCrawlError(nil, err, CekParseURL))
-			c.logFunc(LogError, "ERROR parsing URL %s", v)
+			c.reportError(newCrawlError(nil, err, CekParseURL))
+			c.logFunc(LogError, "ERROR parsing URL %s", v, slog.String("url", v), errAttr(err))
 		} else {
 			res = []*URLContext{ctx}
 		}
@@ -182,8 +303,8 @@ func (c *Crawler) toURLContexts(raw interface{}, src *url.URL) []*URLContext {
 		for _, s := range v {
 			ctx, err := c.stringToURLContext(s, src)
 			if err != nil {
-				c.Options.Extender.Error(newCrawlError(nil, err, CekParseURL))
-				c.logFunc(LogError, "ERROR parsing URL %s", s)
+				c.reportError(newCrawlError(nil, err, CekParseURL))
+				c.logFunc(LogError, "ERROR parsing URL %s", s, slog.String("url", s), errAttr(err))
 			} else {
 				res = append(res, ctx)
 			}
@@ -198,6 +319,32 @@ func (c *Crawler) toURLContexts(raw interface{}, src *url.URL) []*URLContext {
 			res = append(res, c.urlToURLContext(u, src))
 		}
 
+	case []*Link:
+		res = make([]*URLContext, 0, len(v))
+		for _, l := range v {
+			var u url.URL
+			if l.URL != nil {
+				// Normalization modifies the URL, keep the link's URL as found
+				u = *l.URL
+			} else {
+				// Not resolved yet (e.g. from a LinkExtractor), resolve the raw
+				// value against the source URL
+				pu, err := url.Parse(l.Value)
+				if err != nil {
+					c.reportError(newCrawlError(nil, err, CekParseURL))
+					c.logFunc(LogError, "ERROR parsing URL %s", l.Value, slog.String("url", l.Value), errAttr(err))
+					continue
+				}
+				if src != nil {
+					pu = src.ResolveReference(pu)
+				}
+				u = *pu
+			}
+			ctx := c.urlToURLContext(&u, src)
+			ctx.link = l
+			res = append(res, ctx)
+		}
+
 	case map[string]interface{}:
 		mapString(S(v))
 
@@ -215,7 +362,11 @@ func (c *Crawler) toURLContexts(raw interface{}, src *url.URL) []*URLContext {
 			panic("unsupported URL type passed as empty interface")
 		}
 	}
-	return res
+
+	for _, ctx := range res {
+		ctx.depth = depth
+	}
+	return append(res, kept...)
 }
 
 func (c *Crawler) stringToURLContext(str string, src *url.URL) (*URLContext, error) {
@@ -227,22 +378,25 @@ func (c *Crawler) stringToURLContext(str string, src *url.URL) (*URLContext, err
 }
 
 func (c *Crawler) urlToURLContext(u, src *url.URL) *URLContext {
+	return newURLContext(u, src, c.Options)
+}
+
+func newURLContext(u, src *url.URL, opts *Options) *URLContext {
 	var rawSrc *url.URL
 
 	rawU := *u
-	purell.NormalizeURL(u, c.Options.URLNormalizationFlags)
+	purell.NormalizeURL(u, opts.URLNormalizationFlags)
 	if src != nil {
 		rawSrc = &url.URL{}
 		*rawSrc = *src
-		purell.NormalizeURL(src, c.Options.URLNormalizationFlags)
+		purell.NormalizeURL(src, opts.URLNormalizationFlags)
 	}
 
 	return &URLContext{
-		c.Options.HeadBeforeGet,
-		nil,
-		&rawU,
-		u,
-		rawSrc,
-		src,
+		HeadBeforeGet:       opts.HeadBeforeGet,
+		url:                 &rawU,
+		normalizedURL:       u,
+		sourceURL:           rawSrc,
+		normalizedSourceURL: src,
 	}
 }
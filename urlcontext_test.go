@@ -1,6 +1,7 @@
 package gocrawl
 
 import (
+	"net/url"
 	"reflect"
 	"testing"
 
@@ -15,6 +16,7 @@ func TestCloneForRedirect(t *testing.T) {
 	ctx1, _ := c.stringToURLContext("http://localhost/p1", nil)
 	ctx1.HeadBeforeGet = true
 	ctx1.State = 1
+	ctx1.depth = 2
 	p2, _ := ctx1.URL().Parse("/p2")
 	ctx2 := ctx1.cloneForRedirect(p2, c.Options.URLNormalizationFlags)
 
@@ -53,6 +55,9 @@ func TestCloneForRedirect(t *testing.T) {
 	if !ctx2.HeadBeforeGet {
 		t.Error("want HeadBeforeGet to be true")
 	}
+	if ctx2.Depth() != 2 {
+		t.Errorf("want depth %d, got %d", 2, ctx2.Depth())
+	}
 
 	// test 2: redirect again from p2 to p3, should keep p1 as source
 	p3, _ := ctx2.URL().Parse("/p3")
@@ -92,3 +97,65 @@ func TestCloneForRedirect(t *testing.T) {
 		t.Error("want HeadBeforeGet to be true")
 	}
 }
+
+func TestToURLContextsLinks(t *testing.T) {
+	spy := newSpy(new(DefaultExtender), false)
+	c := NewCrawler(spy)
+	c.logFunc = func(LogFlags, string, ...interface{}) {}
+
+	resolved, _ := url.Parse("http://host/resolved")
+	links := []*Link{
+		{URL: resolved, Value: "resolved", Tag: "a", Attr: "href"},
+		{Value: "relative?q=1", Tag: "a", Attr: "href"},
+		{Value: "http://other/absolute", Tag: "a", Attr: "href"},
+		{Value: "%zz", Tag: "a", Attr: "href"},
+	}
+	parent, _ := c.stringToURLContext("http://host/dir/page", nil)
+	ctxs := c.toURLContexts(links, parent)
+
+	want := []string{"http://host/resolved", "http://host/dir/relative?q=1", "http://other/absolute"}
+	if len(ctxs) != len(want) {
+		t.Fatalf("want %d URLs, got %d", len(want), len(ctxs))
+	}
+	for i, ctx := range ctxs {
+		if got := ctx.URL().String(); got != want[i] {
+			t.Errorf("%d: want %s, got %s", i, want[i], got)
+		}
+		if ctx.Link() != links[i] {
+			t.Errorf("%d: want the link to be kept", i)
+		}
+	}
+	assertCallCount(spy, "ToURLContextsLinks", eMKError, 1, t)
+
+	// Without a source URL, relative links remain relative
+	ctxs = c.toURLContexts([]*Link{{Value: "relative"}}, nil)
+	if len(ctxs) != 1 || ctxs[0].URL().String() != "relative" {
+		t.Errorf("want the relative link, got %v", ctxs)
+	}
+}
+
+func TestToURLContextsContexts(t *testing.T) {
+	c := NewCrawler(new(DefaultExtender))
+
+	parent, _ := c.stringToURLContext("http://host/page", nil)
+	parent.depth = 1
+	other, _ := c.stringToURLContext("http://host/other", nil)
+	other.depth, other.State, other.Priority = 5, "st", 2
+	sm, _ := c.stringToURLContext("http://host/listed", nil)
+	sm.sitemapEntry = &SitemapEntry{}
+
+	ctxs := c.toURLContexts([]*URLContext{other, sm}, parent)
+	if len(ctxs) != 2 {
+		t.Fatalf("want 2 URLs, got %d", len(ctxs))
+	}
+	// A context returned from a visit is one level deeper than the page
+	if ctx := ctxs[0]; ctx == other || ctx.Depth() != 2 || ctx.SourceURL().String() != "http://host/page" {
+		t.Errorf("want a new context at depth 2 from the page, got depth %d from %v", ctx.Depth(), ctx.SourceURL())
+	} else if ctx.State != "st" || ctx.Priority != 2 || ctx.URL().String() != "http://host/other" {
+		t.Errorf("want the state, priority and URL to be kept, got %v, %d, %s", ctx.State, ctx.Priority, ctx.URL())
+	}
+	// A context created from a sitemap is kept
+	if ctxs[1] != sm || sm.Depth() != 0 {
+		t.Errorf("want the sitemap context to be kept at depth 0, got depth %d", ctxs[1].Depth())
+	}
+}
@@ -0,0 +1,119 @@
+package gocrawl
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Validators holds the HTTP cache validators of a fetched URL, used to make
+// conditional requests when the URL is fetched again.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// ValidatorStore is the interface required to save the validators of the
+// fetched URLs, keyed by normalized URL. The DefaultExtender uses a
+// ValidatorStore, if one is set, to add the If-None-Match and
+// If-Modified-Since headers to its requests, and saves the validators of the
+// successful responses. Missing validators only cost a full response, so Set
+// does not report errors. Implementations must be safe for concurrent use.
+type ValidatorStore interface {
+	Get(url string) (Validators, bool)
+	Set(url string, v Validators)
+}
+
+// MemoryValidatorStore is a ValidatorStore that keeps the validators in a
+// map. Entries are never removed, it grows with the number of fetched URLs
+// that return an ETag or Last-Modified header.
+type MemoryValidatorStore struct {
+	mu sync.Mutex
+	m  map[string]Validators
+}
+
+// NewMemoryValidatorStore returns an empty MemoryValidatorStore.
+func NewMemoryValidatorStore() *MemoryValidatorStore {
+	return &MemoryValidatorStore{m: make(map[string]Validators)}
+}
+
+// Get returns the validators of the URL, if any.
+func (ms *MemoryValidatorStore) Get(url string) (Validators, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	v, ok := ms.m[url]
+	return v, ok
+}
+
+// Set saves the validators of the URL.
+func (ms *MemoryValidatorStore) Set(url string, v Validators) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.m[url] = v
+}
+
+// DiskValidatorStore is a ValidatorStore that saves the validators in files
+// in a directory, so that they survive restarts.
+type DiskValidatorStore struct {
+	dir string
+}
+
+// NewDiskValidatorStore returns a DiskValidatorStore that saves the files in
+// the specified directory, which must exist.
+func NewDiskValidatorStore(dir string) *DiskValidatorStore {
+	return &DiskValidatorStore{dir}
+}
+
+// A saved set of validators, the URL guards against hash collisions.
+type validatorsEntry struct {
+	URL string
+	Validators
+}
+
+// Get returns the validators of the URL, if any.
+func (ds *DiskValidatorStore) Get(url string) (Validators, bool) {
+	var e validatorsEntry
+	if err := readGobFile(ds.path(url), &e); err != nil || e.URL != url {
+		return Validators{}, false
+	}
+	return e.Validators, true
+}
+
+// Set replaces the validators of the URL, in a file named after the SHA-1
+// hash of the URL. The previous validators are kept if the file cannot be
+// written.
+func (ds *DiskValidatorStore) Set(url string, v Validators) {
+	writeGobFile(ds.path(url), &validatorsEntry{url, v})
+}
+
+func (ds *DiskValidatorStore) path(url string) string {
+	return hashedPath(ds.dir, url, ".validators")
+}
+
+// Add the conditional headers to the request, based on the stored
+// validators of the URL.
+func setConditionalHeaders(vs ValidatorStore, ctx *URLContext, req *http.Request) {
+	v, ok := vs.Get(ctx.normalizedURL.String())
+	if !ok {
+		return
+	}
+	if v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// Save the validators of a successful response, if any.
+func saveValidators(vs ValidatorStore, ctx *URLContext, res *http.Response) {
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return
+	}
+	v := Validators{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+	}
+	if v.ETag != "" || v.LastModified != "" {
+		vs.Set(ctx.normalizedURL.String(), v)
+	}
+}
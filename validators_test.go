@@ -0,0 +1,177 @@
+package gocrawl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func testValidatorStore(t *testing.T, vs ValidatorStore) {
+	if _, ok := vs.Get("http://host/a"); ok {
+		t.Fatal("expected no validators")
+	}
+	want := Validators{ETag: `"abc"`, LastModified: "Fri, 01 Jan 2021 10:00:00 GMT"}
+	vs.Set("http://host/a", want)
+	if got, ok := vs.Get("http://host/a"); !ok || got != want {
+		t.Errorf("want %+v, got %+v, %v", want, got, ok)
+	}
+}
+
+func TestMemoryValidatorStore(t *testing.T) {
+	testValidatorStore(t, NewMemoryValidatorStore())
+}
+
+func TestDiskValidatorStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawl-validators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testValidatorStore(t, NewDiskValidatorStore(dir))
+	if _, ok := NewDiskValidatorStore(dir).Get("http://host/a"); !ok {
+		t.Error("expected the validators from a new instance")
+	}
+}
+
+type notModifiedExtender struct {
+	*spyExtender
+	cnt int32
+}
+
+func (x *notModifiedExtender) NotModified(ctx *URLContext, res *http.Response) (interface{}, bool) {
+	atomic.AddInt32(&x.cnt, 1)
+	return nil, false
+}
+
+func TestConditionalRecrawl(t *testing.T) {
+	var full int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/":
+			w.Header().Set("Last-Modified", "Fri, 01 Jan 2021 10:00:00 GMT")
+			if r.Header.Get("If-Modified-Since") == "Fri, 01 Jan 2021 10:00:00 GMT" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(&full, 1)
+			w.Write([]byte(`<html><body><a href="/a">a</a></body></html>`))
+		case "/a":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(&full, 1)
+			w.Write([]byte(`<html><body>a</body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	de := &DefaultExtender{ValidatorStore: NewMemoryValidatorStore()}
+	for i := 0; i < 2; i++ {
+		x := &notModifiedExtender{spyExtender: newSpy(de, true)}
+		opts := NewOptions(x)
+		opts.CrawlDelay = 0
+		opts.LogFlags = LogAll
+		c := NewCrawlerWithOptions(opts)
+		c.Run([]string{srv.URL + "/", srv.URL + "/a"})
+
+		wantVisits, wantNotModified := 2, int32(0)
+		if i == 1 {
+			wantVisits, wantNotModified = 0, 2
+		}
+		assertCallCount(x.spyExtender, "ConditionalRecrawl", eMKVisit, wantVisits, t)
+		assertCallCount(x.spyExtender, "ConditionalRecrawl", eMKError, 0, t)
+		if n := atomic.LoadInt32(&x.cnt); n != wantNotModified {
+			t.Errorf("run %d: expected %d calls to NotModified, got %d", i, wantNotModified, n)
+		}
+	}
+	if n := atomic.LoadInt32(&full); n != 2 {
+		t.Errorf("expected 2 full responses, got %d", n)
+	}
+}
+
+// Saves the links of the visited pages, and returns them when the pages are
+// not modified, unless findLinks is set.
+type linksNotModifiedExtender struct {
+	*spyExtender
+	findLinks bool
+	mu        sync.Mutex
+	links     map[string]interface{}
+}
+
+func (x *linksNotModifiedExtender) Visited(ctx *URLContext, harvested interface{}) {
+	x.mu.Lock()
+	x.links[ctx.NormalizedURL().String()] = harvested
+	x.mu.Unlock()
+	x.spyExtender.Visited(ctx, harvested)
+}
+
+func (x *linksNotModifiedExtender) NotModified(ctx *URLContext, res *http.Response) (interface{}, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.links[ctx.NormalizedURL().String()], x.findLinks
+}
+
+func TestNotModifiedLinks(t *testing.T) {
+	var full int32
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a>`,
+		"/a": `<a href="/b">b</a>`,
+		"/b": `b`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Write([]byte("<html><body>" + body + "</body></html>"))
+	}))
+	defer srv.Close()
+
+	for _, findLinks := range []bool{false, true} {
+		atomic.StoreInt32(&full, 0)
+		de := &DefaultExtender{ValidatorStore: NewMemoryValidatorStore()}
+		x := &linksNotModifiedExtender{findLinks: findLinks, links: make(map[string]interface{})}
+		for i := 0; i < 2; i++ {
+			// The second run is seeded with the root page only
+			x.spyExtender = newSpy(de, true)
+			opts := NewOptions(x)
+			opts.CrawlDelay = 0
+			opts.LogFlags = LogAll
+			c := NewCrawlerWithOptions(opts)
+			c.Run(srv.URL + "/")
+		}
+
+		// The whole site is reached on the second run, either with the saved
+		// links or by fetching the pages again
+		wantVisits, wantFull := 0, int32(3)
+		if findLinks {
+			wantVisits, wantFull = 3, 6
+		}
+		name := fmt.Sprintf("NotModifiedLinks-%v", findLinks)
+		assertCallCount(x.spyExtender, name, eMKVisit, wantVisits, t)
+		assertCallCount(x.spyExtender, name, eMKError, 0, t)
+		if n := atomic.LoadInt32(&full); n != wantFull {
+			t.Errorf("%s: expected %d full responses, got %d", name, wantFull, n)
+		}
+		if !findLinks {
+			assertIsInLog(name, x.spyExtender.b, "not modified: "+srv.URL+"/b\n", t)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+// Package warc implements a gocrawl.ResponseSink that archives the fetched
+// responses in WARC 1.1 files.
+//
+// For each response, the Writer writes a request record (rebuilt from the
+// http.Request that produced the response), a response record and a metadata
+// record (with the source URL, the depth and the fetch duration). Each file
+// starts with a warcinfo record. Records are compressed separately (one gzip
+// member per record) so that they can be read independently, and a new file
+// is started when the current one exceeds the maximum size.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/gocrawl"
+)
+
+const (
+	// DefaultMaxSize is the default maximum size of a WARC file.
+	DefaultMaxSize = 1 << 30
+
+	version = "WARC/1.1"
+)
+
+// Writer writes the responses received from the crawler to WARC files. It is
+// safe for concurrent use.
+type Writer struct {
+	// Dir is the directory where the WARC files are created.
+	Dir string
+
+	// Prefix is the prefix of the WARC file names. The file names are
+	// Prefix-<timestamp>-<serial>.warc[.gz].
+	Prefix string
+
+	// MaxSize is the size after which a new WARC file is started. The
+	// records of a response are always written to the same file, so the
+	// size may be exceeded. If zero, a single file is written.
+	MaxSize int64
+
+	// Compress enables the gzip compression of each record.
+	Compress bool
+
+	// Software is written in the warcinfo record of each file.
+	Software string
+
+	mu     sync.Mutex
+	f      *os.File
+	bw     *bufio.Writer
+	size   int64
+	serial int
+	files  []string
+}
+
+// NewWriter returns a Writer that creates compressed WARC files in dir, with
+// the specified file name prefix and the DefaultMaxSize.
+func NewWriter(dir, prefix string) *Writer {
+	return &Writer{
+		Dir:      dir,
+		Prefix:   prefix,
+		MaxSize:  DefaultMaxSize,
+		Compress: true,
+		Software: "gocrawl",
+	}
+}
+
+// Files returns the names of the WARC files created so far.
+func (w *Writer) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.files...)
+}
+
+// WriteResponse implements gocrawl.ResponseSink. It writes the request,
+// response and metadata records of the response.
+func (w *Writer) WriteResponse(fi *gocrawl.FetchInfo, res *http.Response, body []byte) error {
+	date := time.Now().Add(-fi.Duration).UTC()
+	target := res.Request.URL.String()
+
+	respID := newRecordID()
+	resp := &record{
+		typ: "response",
+		header: [][2]string{
+			{"WARC-Record-ID", respID},
+			{"WARC-Date", formatDate(date)},
+			{"WARC-Target-URI", target},
+			{"Content-Type", "application/http;msgtype=response"},
+			{"WARC-Payload-Digest", digest(body)},
+		},
+		block: responseBlock(res, body),
+	}
+	req := &record{
+		typ: "request",
+		header: [][2]string{
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", formatDate(date)},
+			{"WARC-Target-URI", target},
+			{"WARC-Concurrent-To", respID},
+			{"Content-Type", "application/http;msgtype=request"},
+		},
+		block: requestBlock(res.Request),
+	}
+	meta := &record{
+		typ: "metadata",
+		header: [][2]string{
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", formatDate(date)},
+			{"WARC-Target-URI", target},
+			{"WARC-Refers-To", respID},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: metadataBlock(fi),
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotate(); err != nil {
+		return err
+	}
+	for _, r := range []*record{req, resp, meta} {
+		if err := w.write(r); err != nil {
+			return err
+		}
+	}
+	return w.bw.Flush()
+}
+
+// Close closes the current WARC file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.close()
+}
+
+func (w *Writer) close() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.bw.Flush()
+	if e := w.f.Close(); err == nil {
+		err = e
+	}
+	w.f, w.bw = nil, nil
+	return err
+}
+
+// Open a new file if there is none yet or if the current one is full.
+func (w *Writer) rotate() error {
+	if w.f != nil && (w.MaxSize <= 0 || w.size < w.MaxSize) {
+		return nil
+	}
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s-%05d.warc", w.Prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+	if w.Compress {
+		name += ".gz"
+	}
+	f, err := os.OpenFile(filepath.Join(w.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.f, w.bw, w.size = f, bufio.NewWriter(f), 0
+	w.serial++
+	w.files = append(w.files, name)
+
+	info := &record{
+		typ: "warcinfo",
+		header: [][2]string{
+			{"WARC-Record-ID", newRecordID()},
+			{"WARC-Date", formatDate(time.Now().UTC())},
+			{"WARC-Filename", name},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block: fields([][2]string{
+			{"software", w.Software},
+			{"format", "WARC File Format 1.1"},
+			{"conformsTo", "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"},
+		}),
+	}
+	return w.write(info)
+}
+
+// A WARC record, the WARC-Type and Content-Length headers are added when the
+// record is written.
+type record struct {
+	typ    string
+	header [][2]string
+	block  []byte
+}
+
+func (w *Writer) write(r *record) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(version + "\r\n")
+	buf.WriteString("WARC-Type: " + r.typ + "\r\n")
+	for _, h := range r.header {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	if r.typ == "request" || r.typ == "response" {
+		buf.WriteString("WARC-Block-Digest: " + digest(r.block) + "\r\n")
+	}
+	buf.WriteString("Content-Length: " + strconv.Itoa(len(r.block)) + "\r\n\r\n")
+	buf.Write(r.block)
+	buf.WriteString("\r\n\r\n")
+
+	cw := &countWriter{w: w.bw}
+	if w.Compress {
+		gz := gzip.NewWriter(cw)
+		if _, err := buf.WriteTo(gz); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	} else if _, err := buf.WriteTo(cw); err != nil {
+		return err
+	}
+	w.size += cw.n
+	return nil
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Rebuild the HTTP request message. The body of the crawler's requests is
+// always empty.
+func requestBlock(req *http.Request) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	req.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// Rebuild the HTTP response message. Note that the net/http transport may
+// have transparently decompressed the body, in which case the headers
+// describe the decompressed body.
+func responseBlock(res *http.Response, body []byte) []byte {
+	var buf bytes.Buffer
+
+	proto := res.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	status := res.Status
+	if status == "" {
+		status = strconv.Itoa(res.StatusCode) + " " + http.StatusText(res.StatusCode)
+	}
+	fmt.Fprintf(&buf, "%s %s\r\n", proto, status)
+	res.Header.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func metadataBlock(fi *gocrawl.FetchInfo) []byte {
+	var f [][2]string
+
+	if src := fi.Ctx.SourceURL(); src != nil {
+		f = append(f, [2]string{"via", src.String()})
+	}
+	f = append(f, [2]string{"depth", strconv.Itoa(fi.Ctx.Depth())})
+	f = append(f, [2]string{"fetchTimeMs", strconv.FormatInt(int64(fi.Duration/time.Millisecond), 10)})
+	if fi.Ctx.IsRobotsURL() {
+		f = append(f, [2]string{"robots", "true"})
+	}
+	if fi.Ctx.IsSitemapURL() {
+		f = append(f, [2]string{"sitemap", "true"})
+	}
+	return fields(f)
+}
+
+func fields(f [][2]string) []byte {
+	var buf bytes.Buffer
+
+	for _, kv := range f {
+		buf.WriteString(kv[0] + ": " + kv[1] + "\r\n")
+	}
+	return buf.Bytes()
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000000Z")
+}
+
+func digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Return a random (version 4) UUID URN.
+func newRecordID() string {
+	var u [16]byte
+
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
@@ -0,0 +1,166 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/gocrawl"
+	"github.com/PuerkitoBio/goquery"
+)
+
+type visitExtender struct {
+	gocrawl.DefaultExtender
+	bodies map[string]string
+}
+
+func (x *visitExtender) Visit(ctx *gocrawl.URLContext, res *http.Response, doc *goquery.Document) (interface{}, bool) {
+	b, _ := ioutil.ReadAll(res.Body)
+	x.bodies[ctx.URL().Path] = string(b)
+	return nil, true
+}
+
+// Read the WARC-Type of the records of a file, and the whole content.
+func readRecords(t *testing.T, path string) ([]string, string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	br := bufio.NewReader(strings.NewReader(string(b)))
+	for {
+		line, err := br.ReadString('\n')
+		if strings.HasPrefix(line, "WARC-Type: ") {
+			types = append(types, strings.TrimSpace(line[len("WARC-Type: "):]))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return types, string(b)
+}
+
+func TestWriter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/":
+			w.Write([]byte(`<html><body><a href="/a">a</a><a href="/private">p</a></body></html>`))
+		default:
+			w.Write([]byte("<html><body>page " + r.URL.Path + "</body></html>"))
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gocrawl-warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ww := NewWriter(dir, "test")
+	ext := &visitExtender{bodies: make(map[string]string)}
+	opts := gocrawl.NewOptions(ext)
+	opts.CrawlDelay = 0
+	opts.LogFlags = gocrawl.LogNone
+	opts.ResponseSink = ww
+	c := gocrawl.NewCrawlerWithOptions(opts)
+	if err := c.Run(srv.URL + "/"); err != nil && err != gocrawl.ErrMaxVisits {
+		t.Fatal(err)
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ext.bodies["/a"]; got != "<html><body>page /a</body></html>" {
+		t.Errorf("expected the body to be visited, got %q", got)
+	}
+	files := ww.Files()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v", files)
+	}
+	types, content := readRecords(t, filepath.Join(dir, files[0]))
+	// warcinfo, then robots.txt, / and /a
+	want := "warcinfo request response metadata request response metadata request response metadata"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("want record types %q, got %q", want, got)
+	}
+	for _, s := range []string{
+		"WARC-Target-URI: " + srv.URL + "/robots.txt",
+		"robots: true",
+		"GET /a HTTP/1.1",
+		"HTTP/1.1 200 OK",
+		"page /a",
+		"via: " + srv.URL + "/",
+		"depth: 1",
+	} {
+		if !strings.Contains(content, s) {
+			t.Errorf("expected WARC content to contain %q", s)
+		}
+	}
+	if strings.Contains(content, "WARC-Target-URI: "+srv.URL+"/private") {
+		t.Error("expected the disallowed URL not to be archived")
+	}
+}
+
+func TestWriterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocrawl-warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ww := NewWriter(dir, "rot")
+	ww.MaxSize = 1
+	ww.Compress = false
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		res := &http.Response{
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Request:    req,
+		}
+		fi := &gocrawl.FetchInfo{Ctx: &gocrawl.URLContext{}, StatusCode: 200}
+		if err := ww.WriteResponse(fi, res, []byte("body")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ww.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := ww.Files()
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, files[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "WARC/1.1\r\nWARC-Type: warcinfo\r\n") {
+		t.Errorf("expected the file to start with a warcinfo record, got %q", b[:40])
+	}
+	if !strings.Contains(string(b), "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nbody") {
+		t.Errorf("unexpected response record: %q", b)
+	}
+}
@@ -2,10 +2,14 @@ package gocrawl
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,18 +29,41 @@ type worker struct {
 	host  string
 	index int
 
-	// Communication channels and sync
+	// Communication channels and sync. The stop channel is the done
+	// channel of ctx, the drain channel is closed on shutdown.
+	ctx     context.Context
 	push    chan<- *workerResponse
 	pop     popChannel
-	stop    chan struct{}
+	queue   urlQueue
+	retries []*retryURL
+	stop    <-chan struct{}
+	drain   <-chan struct{}
 	enqueue chan<- interface{}
 	wg      *sync.WaitGroup
 
+	// Global limits, shared by all workers
+	slots   chan struct{}
+	limiter *rateLimiter
+	hasSlot bool
+
+	// Pause gates of the crawler and of the host
+	pause     *pauseGate
+	hostPause *pauseGate
+
 	// Robots validation
-	robotsGroup *robotstxt.Group
+	robotsGroup            *robotstxt.Group
+	robotsDisallowAll      bool
+	robotsRetry            bool
+	robotsAttempts         int
+	robotsExpiry           time.Time
+	robotsUnreachableSince time.Time
+
+	// Links harvesting
+	linkExtractors []LinkExtractor
 
-	// Logging
+	// Logging and statistics
 	logFunc func(LogFlags, string, ...interface{})
+	stats   *crawlStats
 
 	// Implementation fields
 	wait           <-chan time.Time
@@ -45,6 +72,12 @@ type worker struct {
 	opts           *Options
 }
 
+// An URL waiting to be retried by the worker.
+type retryURL struct {
+	ctx *URLContext
+	at  time.Time
+}
+
 // Start crawling the host.
 func (w *worker) run() {
 	defer func() {
@@ -54,63 +87,266 @@ func (w *worker) run() {
 
 	// Enter loop to process URLs until stop signal is received
 	for {
-		var idleChan <-chan time.Time
+		// Hand the remaining URLs back to the crawler on shutdown
+		if w.draining() {
+			w.drainURLs()
+			return
+		}
 
-		w.logFunc(LogInfo, "waiting for pop...")
+		w.queueRetries()
+		if w.queue.Len() == 0 {
+			if !w.waitForURLs() {
+				return
+			}
+			continue
+		}
+
+		// Do not fetch while paused, the URLs remain in the queue
+		if !w.waitWhilePaused() {
+			return
+		}
+		if w.draining() {
+			continue
+		}
 
-		// Initialize the idle timeout channel, if required
-		if w.opts.WorkerIdleTTL > 0 {
-			idleChan = time.After(w.opts.WorkerIdleTTL)
+		// Pull the URLs stacked in the meantime, so that they compete on priority
+		// with those already in the queue.
+		select {
+		case batch := <-w.pop:
+			w.queue.push(batch...)
+		default:
+			// Nothing, just continue...
 		}
 
+		ctx := w.queue.pop()
+		w.logFunc(LogInfo, "popped: %s", ctx.url, urlAttr(ctx.url))
+		w.processURL(ctx)
+
+		// No need to check for idle timeout here, no idling while there are
+		// URLs in the queue.
 		select {
 		case <-w.stop:
 			w.logFunc(LogInfo, "stop signal received.")
 			return
+		default:
+			// Nothing, just continue...
+		}
+	}
+}
 
-		case <-idleChan:
-			w.logFunc(LogInfo, "idle timeout received.")
-			w.sendResponse(nil, false, nil, true)
-			return
+// Wait for URLs to be stacked on the pop channel and push them in the queue.
+// Returns false if the worker must terminate.
+func (w *worker) waitForURLs() bool {
+	var idleChan, retryChan <-chan time.Time
+
+	w.logFunc(LogInfo, "waiting for pop...")
+
+	// Initialize the idle timeout channel, if required. The worker is not idle
+	// if URLs are waiting to be retried, or while paused (the idle timeout
+	// starts anew on resume).
+	paused, resumeChan := w.paused()
+	if len(w.retries) > 0 {
+		retryChan = time.After(time.Until(w.retries[0].at))
+	} else if w.opts.WorkerIdleTTL > 0 && !paused {
+		idleChan = time.After(w.opts.WorkerIdleTTL)
+	}
 
-		case batch := <-w.pop:
+	select {
+	case <-w.stop:
+		w.logFunc(LogInfo, "stop signal received.")
+		return false
 
-			// Got a batch of urls to crawl, loop and check at each iteration if a stop
-			// is received.
-			for _, ctx := range batch {
-				w.logFunc(LogInfo, "popped: %s", ctx.url)
+	case <-idleChan:
+		if paused, _ := w.paused(); paused {
+			// Paused while waiting, not idle
+			return true
+		}
+		w.logFunc(LogInfo, "idle timeout received.")
+		w.sendResponse(nil, false, nil, true)
+		return false
 
-				if ctx.IsRobotsURL() {
-					w.requestRobotsTxt(ctx)
-				} else if w.isAllowedPerRobotsPolicies(ctx.url) {
-					w.requestURL(ctx, ctx.HeadBeforeGet)
-				} else {
-					// Must still notify Crawler that this URL was processed, although not visited
-					w.opts.Extender.Disallowed(ctx)
-					w.sendResponse(ctx, false, nil, false)
-				}
+	case <-resumeChan:
+		return true
 
-				// No need to check for idle timeout here, no idling while looping through
-				// a batch of URLs.
-				select {
-				case <-w.stop:
-					w.logFunc(LogInfo, "stop signal received.")
-					return
-				default:
-					// Nothing, just continue...
-				}
-			}
+	case <-w.drain:
+		return true
+
+	case batch := <-w.pop:
+		w.queue.push(batch...)
+		return true
+
+	case <-retryChan:
+		return true
+	}
+}
+
+// Push the URLs that are due for a retry in the queue.
+func (w *worker) queueRetries() {
+	now := time.Now()
+	i := 0
+	for ; i < len(w.retries) && !w.retries[i].at.After(now); i++ {
+		w.queue.push(w.retries[i].ctx)
+	}
+	w.retries = w.retries[i:]
+}
+
+// Schedule a retry of the URL that failed with the response's status code or
+// the error, if the retry policy allows it. Returns true if the URL will be
+// retried, in which case the failure must not be reported.
+func (w *worker) retry(ctx *URLContext, res *http.Response, err error) bool {
+	var delay time.Duration
+	var ok bool
+
+	if w.ctx.Err() != nil {
+		// Stopping, no retry
+		return false
+	}
+	if r, isRetrier := extenderAs[Retrier](w.opts.Extender); isRetrier {
+		delay, ok = r.Retry(ctx, res, err, ctx.attempts+1)
+	} else if w.opts.RetryPolicy != nil {
+		delay, ok = w.opts.RetryPolicy.Retry(res, err, ctx.attempts+1)
+	}
+	if !ok {
+		return false
+	}
+
+	w.scheduleRetry(ctx, delay)
+	return true
+}
+
+// Schedule a retry of the URL that failed with the response's status code,
+// pausing the host first if it is throttling the crawler. The retry is
+// decided once, by throttle or by retry. Returns true if the URL will be
+// retried, in which case the failure must not be reported.
+func (w *worker) retryStatus(ctx *URLContext, res *http.Response) bool {
+	if isThrottled(res.StatusCode, res.Header) {
+		return w.throttle(ctx, res)
+	}
+	return w.retry(ctx, res, nil)
+}
+
+// Pause the host that is throttling the crawler (429 status code, or 503
+// with a Retry-After header), and schedule a retry of the URL once the pause
+// is over. Returns true if the URL will be retried.
+func (w *worker) throttle(ctx *URLContext, res *http.Response) bool {
+	var delay time.Duration
+	var ok bool
+
+	// Pause the host for at least the Retry-After delay
+	pause := w.lastFetch.RetryAfter
+	if pause < w.lastCrawlDelay {
+		pause = w.lastCrawlDelay
+	}
+	w.wait = time.After(pause)
+	w.logFunc(LogInfo, "host throttled with status %d, pausing for %v", res.StatusCode, pause, urlAttr(ctx.url), statusAttr(res.StatusCode), durationAttr(pause))
+
+	if w.ctx.Err() != nil {
+		// Stopping, no retry
+		return false
+	}
+	if r, isRetrier := extenderAs[Retrier](w.opts.Extender); isRetrier {
+		delay, ok = r.Retry(ctx, res, nil, ctx.attempts+1)
+	} else {
+		maxAttempts := DefaultThrottleMaxAttempts
+		if w.opts.RetryPolicy != nil {
+			maxAttempts = w.opts.RetryPolicy.MaxAttempts
 		}
+		ok = ctx.attempts+1 < maxAttempts
 	}
+	if !ok {
+		return false
+	}
+	w.scheduleRetry(ctx, delay)
+	return true
+}
+
+// Schedule a retry of the URL after the delay.
+func (w *worker) scheduleRetry(ctx *URLContext, delay time.Duration) {
+	ctx.attempts++
+	w.postpone(ctx, time.Now().Add(delay))
+	w.logFunc(LogInfo, "retry #%d of %s in %v", ctx.attempts, ctx.url, delay, urlAttr(ctx.url), slog.Int("attempt", ctx.attempts), durationAttr(delay))
+}
+
+// Keep the URL in the retries until the specified time.
+func (w *worker) postpone(ctx *URLContext, at time.Time) {
+	i := sort.Search(len(w.retries), func(i int) bool {
+		return w.retries[i].at.After(at)
+	})
+	w.retries = append(w.retries, nil)
+	copy(w.retries[i+1:], w.retries[i:])
+	w.retries[i] = &retryURL{ctx, at}
+}
+
+// Process the specified URL, within a context derived from the worker's context
+// that is cancelled once the URL is done.
+func (w *worker) processURL(ctx *URLContext) {
+	reqCtx, cancel := context.WithCancel(w.ctx)
+	ctx.reqCtx = reqCtx
+	defer func() {
+		cancel()
+		ctx.reqCtx = nil
+		w.releaseSlot()
+	}()
+
+	if ctx.IsRobotsURL() {
+		w.requestRobotsTxt(ctx)
+		return
+	}
+	if ctx.sitemap {
+		w.processSitemap(ctx)
+		return
+	}
+
+	w.refreshRobotsTxt(ctx)
+	if w.postponeOnRobots(ctx) {
+		return
+	}
+	if w.isAllowedPerRobotsPolicies(ctx.url) {
+		w.requestURL(ctx, ctx.HeadBeforeGet)
+	} else {
+		// Must still notify Crawler that this URL was processed, although not visited
+		w.opts.Extender.Disallowed(ctx)
+		w.sendResponse(ctx, false, nil, false)
+	}
+}
+
+// Process a sitemap enqueued by the worker of another host, as per this
+// host's robots.txt, and notify the crawler once it is done.
+func (w *worker) processSitemap(ctx *URLContext) {
+	w.refreshRobotsTxt(ctx)
+	if w.postponeOnRobots(ctx) {
+		return
+	}
+	if w.isAllowedPerRobotsPolicies(ctx.url) {
+		w.fetchSitemap(ctx)
+	}
+	w.sendResponse(ctx, false, nil, false)
+}
+
+// Keep the URL until the robots.txt is fetched again, if it is unreachable
+// and will be retried. Returns true if the URL was postponed.
+func (w *worker) postponeOnRobots(ctx *URLContext) bool {
+	if !w.robotsRetry {
+		return false
+	}
+	w.postpone(ctx, w.robotsExpiry)
+	w.logFunc(LogInfo, "robots.txt unreachable, postponing %s", ctx.url, urlAttr(ctx.url))
+	return true
 }
 
 // Checks if the given URL can be fetched based on robots.txt policies.
 func (w *worker) isAllowedPerRobotsPolicies(u *url.URL) bool {
+	if w.robotsDisallowAll {
+		w.stats.ignore("robots-unreachable")
+		w.logFunc(LogIgnored, "ignored on unreachable robots.txt policy: %s", u.String(), urlAttr(u))
+		return false
+	}
 	if w.robotsGroup != nil {
 		// Is this URL allowed per robots.txt policy?
 		ok := w.robotsGroup.Test(u.Path)
 		if !ok {
-			w.logFunc(LogIgnored, "ignored on robots.txt policy: %s", u.String())
+			w.stats.ignore("robots")
+			w.logFunc(LogIgnored, "ignored on robots.txt policy: %s", u.String(), urlAttr(u))
 		}
 		return ok
 	}
@@ -131,39 +367,164 @@ func (w *worker) requestURL(ctx *URLContext, headRequest bool) {
 		// Any 2xx status code is good to go
 		if res.StatusCode >= 200 && res.StatusCode < 300 {
 			// Success, visit the URL
-			harvested = w.visitURL(ctx, res)
-			visited = true
+			harvested, visited = w.visitURL(ctx, res)
+		} else if res.StatusCode == http.StatusNotModified {
+			// Unchanged since the last fetch, not an error
+			w.logFunc(LogInfo, "not modified: %s", ctx.url, urlAttr(ctx.url), statusAttr(res.StatusCode))
+			if nm, ok := extenderAs[NotModifiedVisitor](w.opts.Extender); ok {
+				var findLinks bool
+				if harvested, findLinks = nm.NotModified(ctx, res); findLinks && !ctx.unconditional {
+					// No document to find the links, fetch it again without
+					// the conditional headers
+					w.logFunc(LogInfo, "fetching %s again to find its links", ctx.url, urlAttr(ctx.url))
+					ctx.unconditional = true
+					w.requestURL(ctx, false)
+					return
+				}
+			}
+			ctx.notModified = true
+		} else if w.retryStatus(ctx, res) {
+			// Will be fetched again, do not notify the crawler
+			return
 		} else {
 			// Error based on status code received
-			w.opts.Extender.Error(newCrawlErrorMessage(ctx, res.Status, CekHttpStatusCode))
-			w.logFunc(LogError, "ERROR status code for %s: %s", ctx.url, res.Status)
+			w.reportError(newCrawlErrorMessage(ctx, res.Status, CekHttpStatusCode))
+			w.logFunc(LogError, "ERROR status code for %s: %s", ctx.url, res.Status, urlAttr(ctx.url), statusAttr(res.StatusCode))
 		}
 		w.sendResponse(ctx, visited, harvested, false)
 	}
 }
 
-// Process the robots.txt URL.
+// The robots.txt fetch semantics, as per RFC 9309. These are variables so
+// that they can be adjusted in tests.
+var (
+	// Maximum size of the robots.txt content that is parsed.
+	robotsMaxSize int64 = 500 * 1024
+
+	// Duration after which the robots.txt is fetched again.
+	robotsMaxAge = 24 * time.Hour
+
+	// Duration after which an unreachable robots.txt no longer disallows
+	// all URLs.
+	robotsMaxUnreachable = 30 * 24 * time.Hour
+)
+
+// Process the robots.txt URL. If the robots.txt is unreachable (a server
+// error or a network error), the URLs are not fetched until it is fetched
+// again, up to Options.RobotsMaxAttempts times, after which they are
+// disallowed.
 func (w *worker) requestRobotsTxt(ctx *URLContext) {
+	var data *robotstxt.RobotsData
+	var unreachable bool
+
 	// Ask if it should be fetched
 	if robData, reqRob := w.opts.Extender.RequestRobots(ctx, w.opts.RobotUserAgent); !reqRob {
 		w.logFunc(LogInfo, "using robots.txt from cache")
-		w.robotsGroup = w.getRobotsTxtGroup(ctx, robData, nil)
+		data = w.getRobotsTxtData(ctx, robData, nil)
 
 	} else if res, ok := w.fetchURL(ctx, w.opts.UserAgent, false); ok {
 		// Close the body on function end
 		defer res.Body.Close()
-		w.robotsGroup = w.getRobotsTxtGroup(ctx, nil, res)
+		if unreachable = isRobotsUnreachable(res.StatusCode); unreachable {
+			w.opts.Extender.FetchedRobots(ctx, res)
+		} else if res.StatusCode >= 300 && res.StatusCode < 400 {
+			// Too many redirects, the robots.txt is unavailable
+			w.logFunc(LogInfo, "robots.txt redirected too many times for host %s, allow all", w.host)
+			w.opts.Extender.FetchedRobots(ctx, res)
+		} else {
+			data = w.getRobotsTxtData(ctx, nil, res)
+		}
+
+	} else if w.ctx.Err() != nil || w.draining() {
+		// Stopping or shutting down, nothing to do
+		return
+
+	} else {
+		unreachable = true
+	}
+
+	w.setRobotsTxtData(data, unreachable)
+	if data != nil && w.opts.FetchSitemaps {
+		for _, sm := range data.Sitemaps {
+			w.requestSitemap(ctx, sm, 0)
+		}
 	}
 }
 
-// Get the robots.txt group for this crawler.
-func (w *worker) getRobotsTxtGroup(ctx *URLContext, b []byte, res *http.Response) (g *robotstxt.Group) {
-	var data *robotstxt.RobotsData
+// Fetch the robots.txt again if it is expired.
+func (w *worker) refreshRobotsTxt(ctx *URLContext) {
+	if w.robotsExpiry.IsZero() || time.Now().Before(w.robotsExpiry) {
+		return
+	}
+	robCtx, err := ctx.getRobotsURLCtx()
+	if err != nil {
+		return
+	}
+	w.logFunc(LogInfo, "robots.txt expired, fetching %s", robCtx.url, urlAttr(robCtx.url))
+	robCtx.reqCtx = ctx.reqCtx
+	w.requestRobotsTxt(robCtx)
+}
+
+// Set the robots.txt rules of the host, based on the robots.txt data and
+// whether it was reachable or not.
+func (w *worker) setRobotsTxtData(data *robotstxt.RobotsData, unreachable bool) {
+	now := time.Now()
+
+	if unreachable {
+		if w.robotsUnreachableSince.IsZero() {
+			w.robotsUnreachableSince = now
+		}
+		w.robotsAttempts++
+		w.robotsRetry = w.robotsAttempts < w.opts.RobotsMaxAttempts
+		// After a long time, keep the last known rules, if any
+		w.robotsDisallowAll = now.Sub(w.robotsUnreachableSince) < robotsMaxUnreachable
+		switch {
+		case !w.robotsDisallowAll:
+			w.robotsRetry = false
+			w.robotsExpiry = now.Add(robotsMaxAge)
+		case w.robotsRetry:
+			w.robotsExpiry = now.Add(w.opts.RobotsRetryDelay)
+			w.logFunc(LogInfo, "robots.txt unreachable for host %s, fetching again in %v", w.host, w.opts.RobotsRetryDelay, durationAttr(w.opts.RobotsRetryDelay))
+		default:
+			w.robotsExpiry = now.Add(robotsMaxAge)
+			w.logFunc(LogInfo, "robots.txt unreachable for host %s after %d attempt(s), disallow all", w.host, w.robotsAttempts, slog.Int("attempt", w.robotsAttempts))
+		}
+		return
+	}
+
+	w.robotsUnreachableSince = time.Time{}
+	w.robotsAttempts = 0
+	w.robotsExpiry = now.Add(robotsMaxAge)
+	w.robotsDisallowAll, w.robotsRetry = false, false
+	w.robotsGroup = nil
+	if data != nil {
+		w.robotsGroup = data.FindGroup(w.opts.RobotUserAgent)
+	}
+}
+
+// Indicates if the robots.txt status code means that it is unreachable, in
+// which case no URL is fetched. This is a server error, or 429 (too many
+// requests) that is treated like a server error.
+func isRobotsUnreachable(statusCode int) bool {
+	return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
+// Indicates if the robots.txt status code means that it is unavailable, in
+// which case all URLs are allowed. This is a 4xx status code other than 429,
+// or a redirection that was not followed (too many redirects).
+func isRobotsUnavailable(statusCode int) bool {
+	return statusCode >= 300 && statusCode < 500 && statusCode != http.StatusTooManyRequests
+}
+
+// Get the robots.txt data for this crawler. Only the first robotsMaxSize
+// bytes of the robots.txt are parsed.
+func (w *worker) getRobotsTxtData(ctx *URLContext, b []byte, res *http.Response) (data *robotstxt.RobotsData) {
 	var e error
 
 	if res != nil {
 		var buf bytes.Buffer
-		io.Copy(&buf, res.Body)
+		io.Copy(&buf, io.LimitReader(res.Body, robotsMaxSize))
+		res.Body.Close()
 		res.Body = ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
 		data, e = robotstxt.FromResponse(res)
 		// Rewind the res.Body (by re-creating it from the bytes)
@@ -171,6 +532,9 @@ func (w *worker) getRobotsTxtGroup(ctx *URLContext, b []byte, res *http.Response
 		// Error or not, the robots.txt has been fetched, so notify
 		w.opts.Extender.FetchedRobots(ctx, res)
 	} else {
+		if int64(len(b)) > robotsMaxSize {
+			b = b[:robotsMaxSize]
+		}
 		data, e = robotstxt.FromBytes(b)
 	}
 
@@ -178,29 +542,33 @@ func (w *worker) getRobotsTxtGroup(ctx *URLContext, b []byte, res *http.Response
 	// Reasonable, since by default no robots.txt means full access, so invalid
 	// robots.txt is similar behavior.
 	if e != nil {
-		w.opts.Extender.Error(newCrawlError(nil, e, CekParseRobots))
-		w.logFunc(LogError, "ERROR parsing robots.txt for host %s: %s", w.host, e)
-	} else {
-		g = data.FindGroup(w.opts.RobotUserAgent)
+		w.reportError(newCrawlError(nil, e, CekParseRobots))
+		w.logFunc(LogError, "ERROR parsing robots.txt for host %s: %s", w.host, e, errAttr(e))
+		return nil
 	}
-	return g
+	return data
 }
 
 // Set the crawl delay between this request and the next.
 func (w *worker) setCrawlDelay() {
-	var robDelay time.Duration
+	var robDelay, retryAfter time.Duration
 
 	if w.robotsGroup != nil {
 		robDelay = w.robotsGroup.CrawlDelay
 	}
+	if w.lastFetch != nil {
+		retryAfter = w.lastFetch.RetryAfter
+	}
 	w.lastCrawlDelay = w.opts.Extender.ComputeDelay(w.host,
 		&DelayInfo{
-			w.opts.CrawlDelay,
-			robDelay,
-			w.lastCrawlDelay,
+			OptsDelay:   w.opts.CrawlDelay,
+			RobotsDelay: robDelay,
+			LastDelay:   w.lastCrawlDelay,
+			RetryAfter:  retryAfter,
 		},
 		w.lastFetch)
-	w.logFunc(LogInfo, "using crawl-delay: %v", w.lastCrawlDelay)
+	w.logFunc(LogInfo, "using crawl-delay: %v", w.lastCrawlDelay, durationAttr(w.lastCrawlDelay))
+	w.stats.updateHost(w.host, func(hs *HostStats) { hs.CrawlDelay = w.lastCrawlDelay })
 }
 
 // Request the specified URL and return the response.
@@ -212,10 +580,28 @@ func (w *worker) fetchURL(ctx *URLContext, agent string, headRequest bool) (res
 		// Wait for crawl delay, if one is pending.
 		w.logFunc(LogTrace, "waiting for crawl delay")
 		if w.wait != nil {
-			<-w.wait
+			select {
+			case <-w.wait:
+			case <-w.drain:
+				w.keepOnDrain(ctx)
+				return nil, false
+			case <-w.stop:
+				w.logFunc(LogInfo, "stop signal received.")
+				return nil, false
+			}
 			w.wait = nil
 		}
 
+		// Wait for the global limits, if any
+		if !w.acquireSlot() || !w.waitRateLimit() {
+			if w.draining() {
+				w.keepOnDrain(ctx)
+			} else {
+				w.logFunc(LogInfo, "stop signal received.")
+			}
+			return nil, false
+		}
+
 		// Compute the next delay
 		w.setCrawlDelay()
 
@@ -237,13 +623,18 @@ func (w *worker) fetchURL(ctx *URLContext, agent string, headRequest bool) (res
 					// Absolute URLs that point to another host are ok too.
 					if ur, e := ctx.url.Parse(ue.URL); e != nil {
 						// Notify error
-						w.opts.Extender.Error(newCrawlError(nil, e, CekParseRedirectURL))
-						w.logFunc(LogError, "ERROR parsing redirect URL %s: %s", ue.URL, e)
+						w.reportError(newCrawlError(nil, e, CekParseRedirectURL))
+						w.logFunc(LogError, "ERROR parsing redirect URL %s: %s", ue.URL, e, slog.String("url", ue.URL), errAttr(e))
 					} else {
-						w.logFunc(LogTrace, "redirect to %s from %s, linked from %s", ur, ctx.URL(), ctx.SourceURL())
-						// Enqueue the redirect-to URL with the original source
-						rCtx := ctx.cloneForRedirect(ur, w.opts.URLNormalizationFlags)
-						w.enqueue <- rCtx
+						w.logFunc(LogTrace, "redirect to %s from %s, linked from %s", ur, ctx.URL(), ctx.SourceURL(), urlAttr(ctx.url), slog.String("redirect", ur.String()))
+						if ctx.sitemap {
+							// Sitemaps are not enqueued, the worker follows the redirect
+							ctx.redirect = ur
+						} else {
+							// Enqueue the redirect-to URL with the original source
+							rCtx := ctx.cloneForRedirect(ur, w.opts.URLNormalizationFlags)
+							w.enqueue <- rCtx
+						}
 					}
 				}
 			}
@@ -251,38 +642,66 @@ func (w *worker) fetchURL(ctx *URLContext, agent string, headRequest bool) (res
 			// No fetch, so set to nil
 			w.lastFetch = nil
 
+			if !silent && !ctx.IsRobotsURL() && !ctx.sitemap && w.retry(ctx, nil, e) {
+				// Will be fetched again, do not notify the crawler
+				return nil, false
+			}
+			if !silent && w.ctx.Err() != nil {
+				// The request was aborted because the crawler is stopping
+				silent = true
+				w.logFunc(LogInfo, "fetch aborted, will stop: %s", ctx.url, urlAttr(ctx.url))
+			}
 			if !silent {
 				// Notify error
-				w.opts.Extender.Error(newCrawlError(ctx, e, CekFetch))
-				w.logFunc(LogError, "ERROR fetching %s: %s", ctx.url, e)
+				w.reportError(newCrawlError(ctx, e, CekFetch))
+				w.logFunc(LogError, "ERROR fetching %s: %s", ctx.url, e, urlAttr(ctx.url), errAttr(e))
 			}
 
-			// Return from this URL crawl
-			w.sendResponse(ctx, false, nil, false)
+			// Return from this URL crawl, the caller notifies the crawler
+			// for a sitemap
+			if !ctx.sitemap {
+				w.sendResponse(ctx, false, nil, false)
+			}
 			return nil, false
 
 		}
+		if w.stats != nil {
+			res.Body = &countingBody{res.Body, w.stats}
+		}
 		// Get the fetch duration
 		fetchDuration := time.Now().Sub(now)
-		// Crawl delay starts now.
-		w.wait = time.After(w.lastCrawlDelay)
+		w.logFunc(LogTrace, "fetched %s: %d in %v", ctx.url, res.StatusCode, fetchDuration, urlAttr(ctx.url), statusAttr(res.StatusCode), durationAttr(fetchDuration))
+		// Crawl delay starts now, unless the host has no robots.txt (there was
+		// no content to serve).
+		if !ctx.IsRobotsURL() || !isRobotsUnavailable(res.StatusCode) {
+			w.wait = time.After(w.lastCrawlDelay)
+		}
 
 		// Keep trace of this last fetch info
 		w.lastFetch = &FetchInfo{
-			ctx,
-			fetchDuration,
-			res.StatusCode,
-			headRequest,
+			Ctx:           ctx,
+			Duration:      fetchDuration,
+			StatusCode:    res.StatusCode,
+			IsHeadRequest: headRequest,
+		}
+		if isThrottled(res.StatusCode, res.Header) {
+			w.lastFetch.RetryAfter, _ = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		}
+		if w.opts.ResponseSink != nil {
+			w.writeResponse(ctx, res)
 		}
 
 		if headRequest {
 			// Close the HEAD request's body
 			defer res.Body.Close()
-			// Next up is GET request, maybe
+			// Next up is GET request, maybe, do not hold the fetch slot
+			// while waiting for the crawl delay
 			headRequest = false
+			w.releaseSlot()
 			// Ask caller if we should proceed with a GET
 			if !w.opts.Extender.RequestGet(ctx, res) {
-				w.logFunc(LogIgnored, "ignored on HEAD filter policy: %s", ctx.url)
+				w.stats.ignore("head-filter")
+				w.logFunc(LogIgnored, "ignored on HEAD filter policy: %s", ctx.url, urlAttr(ctx.url), statusAttr(res.StatusCode))
 				w.sendResponse(ctx, false, nil, false)
 				ok = false
 				break
@@ -295,6 +714,70 @@ func (w *worker) fetchURL(ctx *URLContext, agent string, headRequest bool) (res
 	return
 }
 
+// Pass the response to the ResponseSink before it is consumed. The body is
+// read in full and replaced, so that it can still be read afterwards.
+func (w *worker) writeResponse(ctx *URLContext, res *http.Response) {
+	bd, e := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(bd))
+	if e != nil {
+		w.reportError(newCrawlError(ctx, e, CekReadBody))
+		w.logFunc(LogError, "ERROR reading body %s: %s", ctx.url, e, urlAttr(ctx.url), errAttr(e))
+		return
+	}
+	if e = w.opts.ResponseSink.WriteResponse(w.lastFetch, res, bd); e != nil {
+		w.reportError(newCrawlError(ctx, e, CekResponseSink))
+		w.logFunc(LogError, "ERROR writing response %s: %s", ctx.url, e, urlAttr(ctx.url), errAttr(e))
+	}
+}
+
+// Acquire a fetch slot if the number of concurrent hosts is limited. Returns
+// false if a stop or shutdown signal was received while waiting.
+func (w *worker) acquireSlot() bool {
+	if w.slots == nil || w.hasSlot {
+		return true
+	}
+	w.logFunc(LogTrace, "waiting for fetch slot")
+	select {
+	case w.slots <- struct{}{}:
+		w.hasSlot = true
+		return true
+	case <-w.drain:
+		return false
+	case <-w.stop:
+		return false
+	}
+}
+
+// Release the fetch slot, if the worker holds one.
+func (w *worker) releaseSlot() {
+	if w.hasSlot {
+		<-w.slots
+		w.hasSlot = false
+	}
+}
+
+// Wait for the global rate limit, if any. Returns false if a stop or
+// shutdown signal was received while waiting.
+func (w *worker) waitRateLimit() bool {
+	if w.limiter == nil {
+		return true
+	}
+	d := w.limiter.reserve()
+	if d <= 0 {
+		return true
+	}
+	w.logFunc(LogTrace, "waiting %v for rate limit", d, durationAttr(d))
+	select {
+	case <-time.After(d):
+		return true
+	case <-w.drain:
+		return false
+	case <-w.stop:
+		return false
+	}
+}
+
 // Send a response to the crawler.
 func (w *worker) sendResponse(ctx *URLContext, visited bool, harvested interface{}, idleDeath bool) {
 	// Push harvested urls back to crawler, even if empty (uses the channel communication
@@ -317,47 +800,83 @@ func (w *worker) sendResponse(ctx *URLContext, visited bool, harvested interface
 			harvested,
 			w.host,
 			idleDeath,
+			nil,
 		}
 		w.push <- res
 	}
 }
 
 // Process the response for a URL.
-func (w *worker) visitURL(ctx *URLContext, res *http.Response) interface{} {
+func (w *worker) visitURL(ctx *URLContext, res *http.Response) (harvested interface{}, visited bool) {
 	var doc *goquery.Document
-	var harvested interface{}
+	var links []*Link
 	var doLinks bool
 
 	// Load a goquery document and call the visitor function
 	if bd, e := ioutil.ReadAll(res.Body); e != nil {
-		w.opts.Extender.Error(newCrawlError(ctx, e, CekReadBody))
-		w.logFunc(LogError, "ERROR reading body %s: %s", ctx.url, e)
+		w.reportError(newCrawlError(ctx, e, CekReadBody))
+		w.logFunc(LogError, "ERROR reading body %s: %s", ctx.url, e, urlAttr(ctx.url), errAttr(e))
 	} else {
 		if node, e := html.Parse(bytes.NewBuffer(bd)); e != nil {
-			w.opts.Extender.Error(newCrawlError(ctx, e, CekParseBody))
-			w.logFunc(LogError, "ERROR parsing %s: %s", ctx.url, e)
+			w.reportError(newCrawlError(ctx, e, CekParseBody))
+			w.logFunc(LogError, "ERROR parsing %s: %s", ctx.url, e, urlAttr(ctx.url), errAttr(e))
 		} else {
 			doc = goquery.NewDocumentFromNode(node)
 			doc.Url = res.Request.URL
 		}
+		ctx.robots = getRobotsDirectives(w.opts.RobotUserAgent, res.Header, doc)
+		ctx.canonicalURL = getCanonicalURL(ctx, res.Header, doc, w.opts.URLNormalizationFlags)
 		// Re-assign the body so it can be consumed by the visitor function
 		res.Body = ioutil.NopCloser(bytes.NewBuffer(bd))
+		if w.opts.RevisitPolicy != nil {
+			// Used to detect changes between visits
+			sum := sha256.Sum256(bd)
+			ctx.contentHash = sum[:]
+		}
+		if w.opts.DuplicateDetector != nil && w.isDuplicate(ctx, bd, doc) {
+			return nil, false
+		}
 	}
 
 	// Visit the document (with nil goquery doc if failed to load)
 	if harvested, doLinks = w.opts.Extender.Visit(ctx, res, doc); doLinks {
 		// Links were not processed by the visitor, so process links
 		if doc != nil {
-			harvested = w.processLinks(doc)
+			links = w.processLinks(ctx, doc)
+			harvested = linkURLs(links)
 		} else {
-			w.opts.Extender.Error(newCrawlErrorMessage(ctx, "No goquery document to process links.", CekProcessLinks))
-			w.logFunc(LogError, "ERROR processing links %s", ctx.url)
+			w.reportError(newCrawlErrorMessage(ctx, "No goquery document to process links.", CekProcessLinks))
+			w.logFunc(LogError, "ERROR processing links %s", ctx.url, urlAttr(ctx.url))
 		}
 	}
 	// Notify that this URL has been visited
 	w.opts.Extender.Visited(ctx, harvested)
 
-	return harvested
+	if links != nil {
+		// The crawler keeps the link of each URL (see URLContext.Link)
+		return links, true
+	}
+	return harvested, true
+}
+
+// Check if the content is a duplicate of an already visited document, in
+// which case the URL is skipped (not visited and its links not harvested),
+// unless the DuplicateVisitor asks to visit it anyway.
+func (w *worker) isDuplicate(ctx *URLContext, body []byte, doc *goquery.Document) bool {
+	var text string
+	if doc != nil {
+		text = doc.Text()
+	}
+	orig, exact := w.opts.DuplicateDetector.Check(ctx.normalizedURL, body, text)
+	if orig == nil {
+		return false
+	}
+	if dv, ok := extenderAs[DuplicateVisitor](w.opts.Extender); ok && dv.Duplicate(ctx, orig, exact) {
+		return false
+	}
+	w.stats.ignore("duplicate")
+	w.logFunc(LogIgnored, "ignore on duplicate content policy: %s (original %s)", ctx.url, orig, urlAttr(ctx.url), slog.String("original", orig.String()))
+	return true
 }
 
 func handleBaseTag(root *url.URL, baseHref string, aHref string) string {
@@ -383,28 +902,38 @@ func handleBaseTag(root *url.URL, baseHref string, aHref string) string {
 }
 
 var (
-	aHrefMatcher    = cascadia.MustCompile("a[href]")
 	baseHrefMatcher = cascadia.MustCompile("base[href]")
 )
 
 // Scrape the document's content to gather all links
-func (w *worker) processLinks(doc *goquery.Document) (result []*url.URL) {
+func (w *worker) processLinks(ctx *URLContext, doc *goquery.Document) (result []*Link) {
+	if w.opts.HonorRobotsDirectives && ctx.robots.NoFollow {
+		w.stats.ignore("nofollow")
+		w.logFunc(LogIgnored, "ignore links on nofollow policy: %s", ctx.url, urlAttr(ctx.url))
+		return nil
+	}
+
 	baseURL, _ := doc.FindMatcher(baseHrefMatcher).Attr("href")
-	urls := doc.FindMatcher(aHrefMatcher).Map(func(_ int, s *goquery.Selection) string {
-		val, _ := s.Attr("href")
-		if baseURL != "" {
-			val = handleBaseTag(doc.Url, baseURL, val)
-		}
-		return val
-	})
-	for _, s := range urls {
-		// If href starts with "#", then it points to this same exact URL, ignore (will fail to parse anyway)
-		if len(s) > 0 && !strings.HasPrefix(s, "#") {
-			if parsed, e := url.Parse(s); e == nil {
-				parsed = doc.Url.ResolveReference(parsed)
-				result = append(result, parsed)
-			} else {
-				w.logFunc(LogIgnored, "ignore on unparsable policy %s: %s", s, e.Error())
+	for _, le := range w.linkExtractors {
+		for _, l := range le.ExtractLinks(doc) {
+			if w.opts.HonorRobotsDirectives && isNofollowRel(l.Rel) {
+				w.stats.ignore("rel-nofollow")
+				w.logFunc(LogIgnored, "ignore on rel=nofollow policy: %s", l.Value, slog.String("url", l.Value))
+				continue
+			}
+			s := l.Value
+			if baseURL != "" {
+				s = handleBaseTag(doc.Url, baseURL, s)
+			}
+			// If href starts with "#", then it points to this same exact URL, ignore (will fail to parse anyway)
+			if len(s) > 0 && !strings.HasPrefix(s, "#") {
+				if parsed, e := url.Parse(s); e == nil {
+					l.URL = doc.Url.ResolveReference(parsed)
+					result = append(result, l)
+				} else {
+					w.stats.ignore("unparsable")
+					w.logFunc(LogIgnored, "ignore on unparsable policy %s: %s", s, e.Error(), slog.String("url", s), errAttr(e))
+				}
 			}
 		}
 	}